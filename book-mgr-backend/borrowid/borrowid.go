@@ -0,0 +1,70 @@
+package borrowid
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// 借阅号格式为 <8位日期><8位随机数><1位校验码> 共17位数字
+// 校验码采用 Luhn 算法 人工录入时能发现单个数字错误和大部分相邻数字颠倒
+const (
+	Length      = 17
+	randomWidth = 8
+)
+
+var randomLimit = big.NewInt(100000000) // 10^randomWidth
+
+// New 生成一个新的借阅号 唯一性由调用方结合数据库校验
+func New(now time.Time) (string, error) {
+	n, err := rand.Int(rand.Reader, randomLimit)
+	if err != nil {
+		return "", err
+	}
+	body := fmt.Sprintf("%s%0*d", now.Format("20060102"), randomWidth, n.Int64())
+	return body + string(checkDigit(body)), nil
+}
+
+// Normalize 去掉录入时常见的空格和分隔符
+func Normalize(id string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(id))
+}
+
+// IsFormatted 是否为当前格式的借阅号 不校验校验码
+// 早期的借阅号长度不固定 不属于该格式
+func IsFormatted(id string) bool {
+	if len(id) != Length {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '0' || id[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Valid 是否为当前格式且校验码正确
+func Valid(id string) bool {
+	return IsFormatted(id) && checkDigit(id[:Length-1]) == id[Length-1]
+}
+
+// checkDigit 计算 Luhn 校验码
+func checkDigit(digits string) byte {
+	sum := 0
+	double := true
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return byte('0' + (10-sum%10)%10)
+}
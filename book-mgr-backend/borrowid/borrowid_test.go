@@ -0,0 +1,90 @@
+package borrowid
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckDigitKnownValue(t *testing.T) {
+	// Luhn 算法的标准示例 79927398713
+	if got := checkDigit("7992739871"); got != '3' {
+		t.Errorf("checkDigit(7992739871) = %c 期望 3", got)
+	}
+}
+
+func TestNew(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.Local)
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		id, err := New(now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(id, "20240102") {
+			t.Errorf("New() = %s 应以日期开头", id)
+		}
+		if !IsFormatted(id) || !Valid(id) {
+			t.Errorf("New() = %s 校验失败", id)
+		}
+		seen[id] = true
+	}
+	if len(seen) < 90 {
+		t.Errorf("100 次生成中只有 %d 个不同的借阅号", len(seen))
+	}
+}
+
+func TestValidDetectsSingleDigitErrors(t *testing.T) {
+	id, err := New(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < Length; i++ {
+		for d := byte('0'); d <= '9'; d++ {
+			if d == id[i] {
+				continue
+			}
+			typo := id[:i] + string(d) + id[i+1:]
+			if Valid(typo) {
+				t.Errorf("第 %d 位录错为 %c 未被发现: %s", i, d, typo)
+			}
+		}
+	}
+}
+
+func TestValidDetectsAdjacentSwaps(t *testing.T) {
+	id := "2024010212345678"
+	id += string(checkDigit(id))
+	for i := 0; i+1 < Length; i++ {
+		a, b := id[i], id[i+1]
+		// Luhn 无法发现 09 和 90 的互换
+		if a == b || (a == '0' && b == '9') || (a == '9' && b == '0') {
+			continue
+		}
+		swapped := id[:i] + string(b) + string(a) + id[i+2:]
+		if Valid(swapped) {
+			t.Errorf("第 %d 和 %d 位颠倒未被发现: %s", i, i+1, swapped)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	if got := Normalize(" 20240102-1234 5678-9 "); got != "20240102123456789" {
+		t.Errorf("Normalize() = %q", got)
+	}
+}
+
+func TestIsFormatted(t *testing.T) {
+	cases := map[string]bool{
+		"20240102123456789":  true,
+		"2024010212345678":   false, // 少一位
+		"202401021234567890": false, // 多一位
+		"2024010212345678a":  false,
+		"20231231000001":     false, // 早期的借阅号
+	}
+	for id, want := range cases {
+		if got := IsFormatted(id); got != want {
+			t.Errorf("IsFormatted(%q) = %v 期望 %v", id, got, want)
+		}
+	}
+}
@@ -1,27 +1,73 @@
 package main
 
 import (
+	"book-mgr-backend/config"
 	"book-mgr-backend/dao"
-	"book-mgr-backend/model"
+	"book-mgr-backend/migration"
 	"book-mgr-backend/routers"
+	"book-mgr-backend/service"
+	"flag"
+	"log"
+	"os"
+	"time"
 )
 
-func init() {
-	dao.InitMysqlServer()
+func main() {
+	flags := config.RegisterFlags(flag.CommandLine)
+	flag.Parse()
 
-	if err := dao.Db.Model(&model.Book{}).AutoMigrate(&model.Book{}); err != nil {
-		panic(err)
+	conf, err := flags.Load()
+	if err != nil {
+		log.Panicln("加载配置失败 err: ", err)
 	}
-	if err := dao.Db.Model(&model.User{}).AutoMigrate(&model.User{}); err != nil {
-		panic(err)
+	if flags.PrintConfig {
+		if err := conf.Print(os.Stdout); err != nil {
+			log.Panicln(err)
+		}
+		return
 	}
-	if err := dao.Db.Model(&model.History{}).AutoMigrate(&model.History{}); err != nil {
+	// 子命令 migrate up|down|status reindex 和 migrate-password 不签发令牌 不要求签名密钥
+	args := flag.Args()
+	validate := conf.ValidateServe
+	if len(args) > 0 {
+		validate = conf.Validate
+	}
+	if err := validate(); err != nil {
+		log.Panicln("配置无效 err: ", err)
+	}
+	config.Conf = conf
+
+	dao.InitDatabase()
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "migrate":
+			runMigrate(args[1:])
+		case "reindex":
+			runReindex()
+		case "migrate-password":
+			runMigratePassword(args[1:])
+		default:
+			log.Panicln("未知的子命令: " + args[0])
+		}
+		return
+	}
+
+	// 启动前执行或检查数据库迁移
+	if conf.Database.AutoMigrate {
+		if _, err := migration.Up(dao.Db); err != nil {
+			panic(err)
+		}
+	} else if pending, err := migration.Pending(dao.Db); err != nil {
 		panic(err)
+	} else if len(pending) > 0 {
+		panic(migration.ErrPending)
 	}
 
-}
+	// 定期清理超过取书期限的预约
+	go service.RunHoldExpiry(dao.Db, time.Minute)
+	go service.RunIdempotencyPurge(dao.Db, time.Hour)
 
-func main() {
 	var app routers.App
 	app.RunServer()
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"book-mgr-backend/dao"
+	"book-mgr-backend/migration"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+const migrateUsage = "用法: server [参数] migrate up|down [步数]|status"
+
+// runMigrate 处理 migrate 子命令
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		log.Panicln(migrateUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		count, err := migration.Up(dao.Db)
+		if err != nil {
+			log.Panicln(err)
+		}
+		log.Printf("共执行 %d 个迁移", count)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				log.Panicln(migrateUsage)
+			}
+			steps = n
+		}
+		count, err := migration.Down(dao.Db, steps)
+		if err != nil {
+			log.Panicln(err)
+		}
+		log.Printf("共回滚 %d 个迁移", count)
+	case "status":
+		statuses, err := migration.List(dao.Db)
+		if err != nil {
+			log.Panicln(err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, status := range statuses {
+			state, appliedAt := "pending", ""
+			if status.Applied {
+				state = "applied"
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			if status.Unknown {
+				state = "unknown"
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+		}
+		w.Flush()
+	default:
+		log.Panicln(migrateUsage)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"book-mgr-backend/dao"
+	"book-mgr-backend/model"
+	"book-mgr-backend/password"
+	"errors"
+	"flag"
+	"gorm.io/gorm"
+	"log"
+)
+
+// runMigratePassword 将数据库中所有仍以明文保存的密码一次性转换为哈希
+func runMigratePassword(args []string) {
+	fs := flag.NewFlagSet("migrate-password", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "只统计需要迁移的用户 不写入数据库")
+	batchSize := fs.Int("batch", 100, "每批处理的用户数量")
+	fs.Parse(args)
+
+	var total, migrated int
+	var users []model.User
+	result := dao.Db.Model(&model.User{}).FindInBatches(&users, *batchSize, func(tx *gorm.DB, batch int) error {
+		for _, user := range users {
+			total++
+			if password.IsHashed(user.Password) {
+				continue
+			}
+			if *dryRun {
+				migrated++
+				continue
+			}
+			hashed, err := password.Hash(user.Password)
+			if errors.Is(err, password.ErrTooLong) {
+				// 超长的明文无法哈希 留给用户重置密码
+				log.Printf("用户 %d 的密码超过%d字节 已跳过", user.Id, password.MaxLength)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			// 仅当密码未被并发修改时才写入
+			if err := dao.Db.Model(&model.User{}).
+				Where("id = ? AND password = ?", user.Id, user.Password).
+				Update("password", hashed).Error; err != nil {
+				return err
+			}
+			migrated++
+		}
+		return nil
+	})
+	if result.Error != nil {
+		log.Panicln("迁移密码失败 err: ", result.Error)
+	}
+
+	if *dryRun {
+		log.Printf("共检查 %d 个用户 其中 %d 个仍为明文密码", total, migrated)
+		return
+	}
+	log.Printf("共检查 %d 个用户 已迁移 %d 个明文密码", total, migrated)
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"book-mgr-backend/dao"
+	"book-mgr-backend/migration"
+	"book-mgr-backend/service"
+	"log"
+)
+
+// runReindex 按当前的分词和拼音规则重建图书的检索索引和拼音检索键
+// 迁移只按发布时的规则建立索引 也不生成拼音键 升级后和规则调整后需手动执行
+func runReindex() {
+	if pending, err := migration.Pending(dao.Db); err != nil {
+		log.Panicln(err)
+	} else if len(pending) > 0 {
+		log.Panicln(migration.ErrPending)
+	}
+	count, err := service.ReindexBooks(dao.Db)
+	if err != nil {
+		log.Panicln("重建索引失败 err: ", err)
+	}
+	log.Printf("已重建 %d 本图书的索引", count)
+}
@@ -0,0 +1,381 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 未指定配置文件时尝试读取的环境变量
+const configPathEnv = "BOOKMGR_CONFIG"
+
+// 打印配置时用来替换敏感字段的内容
+const redacted = "******"
+
+// MinTokenSecretLength 令牌签名密钥的最小字节数
+const MinTokenSecretLength = 32
+
+// publicSecrets 曾经作为默认值或示例公开过的密钥 任何人都能用它们伪造令牌
+var publicSecrets = []string{"book-mgr-backend-secret", "secret", "changeme"}
+
+// 支持的数据库驱动
+const (
+	DriverMysql    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSqlite   = "sqlite"
+)
+
+type Config struct {
+	Server      ServerConfig      `yaml:"server"`
+	Database    DatabaseConfig    `yaml:"database"`
+	Auth        AuthConfig        `yaml:"auth"`
+	Circulation CirculationConfig `yaml:"circulation"`
+	Fines       FinesConfig       `yaml:"fines"`
+	Limits      LimitsConfig      `yaml:"limits"`
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+}
+
+type ServerConfig struct {
+	Listen         string   `yaml:"listen"`          // 监听地址
+	TLSCertFile    string   `yaml:"tls_cert_file"`   // TLS 证书文件 为空时使用 HTTP
+	TLSKeyFile     string   `yaml:"tls_key_file"`    // TLS 私钥文件
+	AllowedOrigins []string `yaml:"allowed_origins"` // 允许跨域访问的来源 "*" 表示全部
+}
+
+type DatabaseConfig struct {
+	Driver          string        `yaml:"driver"`            // 数据库驱动 mysql postgres sqlite
+	Path            string        `yaml:"path"`              // SQLite 数据库文件路径
+	SSLMode         string        `yaml:"ssl_mode"`          // PostgreSQL 的 sslmode
+	User            string        `yaml:"user"`              // 使用哪个用户来连接数据库
+	Password        string        `yaml:"password"`          // 用户的密码
+	Protocol        string        `yaml:"protocol"`          // 连接的协议
+	Host            string        `yaml:"host"`              // 数据库主机的IP或域名
+	Port            int           `yaml:"port"`              // 数据库连接端口
+	Name            string        `yaml:"name"`              // 操作哪一个数据库
+	MaxOpenConns    int           `yaml:"max_open_conns"`    // 最大打开连接数 0 表示不限制
+	MaxIdleConns    int           `yaml:"max_idle_conns"`    // 最大空闲连接数
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"` // 连接最长存活时间 0 表示不限制
+	AutoMigrate     bool          `yaml:"auto_migrate"`      // 启动时自动执行未执行的迁移
+}
+
+type AuthConfig struct {
+	TokenSecret string        `yaml:"token_secret"` // 令牌签名密钥
+	TokenExpire time.Duration `yaml:"token_expire"` // 令牌有效期
+}
+
+// CirculationConfig 借阅流通相关的规则
+type CirculationConfig struct {
+	LoanDays    int `yaml:"loan_days"`    // 借阅期限(天)
+	RenewDays   int `yaml:"renew_days"`   // 每次续借顺延的天数
+	MaxRenewals int `yaml:"max_renewals"` // 每次借阅最多续借次数
+	// 预约的书到馆后为读者保留的天数
+	HoldPickupDays int `yaml:"hold_pickup_days"`
+}
+
+// FinesConfig 罚款规则 金额单位均为分
+type FinesConfig struct {
+	OverdueDailyCents   int64 `yaml:"overdue_daily_cents"`   // 每超期一天的罚款
+	OverdueCapCents     int64 `yaml:"overdue_cap_cents"`     // 单次借阅超期罚款上限 0 表示不限制
+	LostProcessingCents int64 `yaml:"lost_processing_cents"` // 丢失赔偿在书价之外收取的手续费
+	BlockThresholdCents int64 `yaml:"block_threshold_cents"` // 欠款超过该值时禁止借阅 0 表示不限制
+}
+
+// LimitsConfig 借阅数量限制 值为0时表示不限制
+type LimitsConfig struct {
+	MaxLoansByRole    map[string]int           `yaml:"max_loans_by_role"`    // 各角色同时借阅的上限
+	MaxCopiesPerTitle int                      `yaml:"max_copies_per_title"` // 同一本书最多同时借阅的册数
+	Categories        map[string]CategoryLimit `yaml:"categories"`           // 按图书分类覆盖的限制
+}
+
+// IdempotencyConfig 带 Idempotency-Key 的请求重试时重放首次响应
+type IdempotencyConfig struct {
+	TTL time.Duration `yaml:"ttl"` // 首次响应保留的时长
+}
+
+type CategoryLimit struct {
+	MaxLoans          int `yaml:"max_loans"`            // 该分类下同时借阅的上限
+	MaxCopiesPerTitle int `yaml:"max_copies_per_title"` // 覆盖全局的同一本书册数上限
+}
+
+// Conf 当前生效的配置 由 Load 设置
+var Conf = Default()
+
+// Default 返回默认配置
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Listen:         "localhost:7001",
+			AllowedOrigins: []string{"*"},
+		},
+		Database: DatabaseConfig{
+			Driver:       DriverSqlite,
+			Path:         "book-mgr.db",
+			SSLMode:      "disable",
+			Protocol:     "tcp",
+			MaxOpenConns: 20,
+			MaxIdleConns: 10,
+			AutoMigrate:  true,
+		},
+		Auth: AuthConfig{
+			TokenExpire: 24 * time.Hour,
+		},
+		Circulation: CirculationConfig{
+			LoanDays:       30,
+			RenewDays:      15,
+			MaxRenewals:    2,
+			HoldPickupDays: 3,
+		},
+		Fines: FinesConfig{
+			OverdueDailyCents:   10,
+			OverdueCapCents:     2000,
+			LostProcessingCents: 500,
+			BlockThresholdCents: 1000,
+		},
+		Limits: LimitsConfig{
+			MaxLoansByRole: map[string]int{
+				"user":      5,
+				"librarian": 10,
+				"admin":     10,
+			},
+			MaxCopiesPerTitle: 1,
+		},
+		Idempotency: IdempotencyConfig{
+			TTL: 24 * time.Hour,
+		},
+	}
+}
+
+// Load 依次应用默认值 配置文件和环境变量 path 为空时读取 BOOKMGR_CONFIG 指定的文件
+func Load(path string) (*Config, error) {
+	conf := Default()
+	if path == "" {
+		path = os.Getenv(configPathEnv)
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("读取配置文件失败: %w", err)
+		}
+		if err := yaml.Unmarshal(data, conf); err != nil {
+			return nil, fmt.Errorf("解析配置文件失败: %w", err)
+		}
+	}
+	if err := conf.applyEnv(); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// envOverrides 环境变量到配置项的映射
+func (c *Config) envOverrides() map[string]interface{} {
+	return map[string]interface{}{
+		"BOOKMGR_LISTEN":               &c.Server.Listen,
+		"BOOKMGR_TLS_CERT_FILE":        &c.Server.TLSCertFile,
+		"BOOKMGR_TLS_KEY_FILE":         &c.Server.TLSKeyFile,
+		"BOOKMGR_ALLOWED_ORIGINS":      &c.Server.AllowedOrigins,
+		"BOOKMGR_DB_DRIVER":            &c.Database.Driver,
+		"BOOKMGR_DB_PATH":              &c.Database.Path,
+		"BOOKMGR_DB_SSL_MODE":          &c.Database.SSLMode,
+		"BOOKMGR_DB_USER":              &c.Database.User,
+		"BOOKMGR_DB_PASSWORD":          &c.Database.Password,
+		"BOOKMGR_DB_PROTOCOL":          &c.Database.Protocol,
+		"BOOKMGR_DB_HOST":              &c.Database.Host,
+		"BOOKMGR_DB_PORT":              &c.Database.Port,
+		"BOOKMGR_DB_NAME":              &c.Database.Name,
+		"BOOKMGR_DB_MAX_OPEN_CONNS":    &c.Database.MaxOpenConns,
+		"BOOKMGR_DB_MAX_IDLE_CONNS":    &c.Database.MaxIdleConns,
+		"BOOKMGR_DB_CONN_MAX_LIFETIME": &c.Database.ConnMaxLifetime,
+		"BOOKMGR_DB_AUTO_MIGRATE":      &c.Database.AutoMigrate,
+		"BOOKMGR_TOKEN_SECRET":         &c.Auth.TokenSecret,
+		"BOOKMGR_TOKEN_EXPIRE":         &c.Auth.TokenExpire,
+		"BOOKMGR_LOAN_DAYS":            &c.Circulation.LoanDays,
+		"BOOKMGR_RENEW_DAYS":           &c.Circulation.RenewDays,
+		"BOOKMGR_MAX_RENEWALS":         &c.Circulation.MaxRenewals,
+		"BOOKMGR_HOLD_PICKUP_DAYS":     &c.Circulation.HoldPickupDays,
+		"BOOKMGR_FINE_DAILY_CENTS":     &c.Fines.OverdueDailyCents,
+		"BOOKMGR_FINE_CAP_CENTS":       &c.Fines.OverdueCapCents,
+		"BOOKMGR_FINE_LOST_FEE_CENTS":  &c.Fines.LostProcessingCents,
+		"BOOKMGR_FINE_BLOCK_CENTS":     &c.Fines.BlockThresholdCents,
+		"BOOKMGR_IDEMPOTENCY_TTL":      &c.Idempotency.TTL,
+	}
+}
+
+func (c *Config) applyEnv() error {
+	for name, target := range c.envOverrides() {
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setValue(target, value); err != nil {
+			return fmt.Errorf("环境变量 %s 的值无效: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// setValue 将字符串解析后写入配置项
+func setValue(target interface{}, value string) error {
+	switch t := target.(type) {
+	case *string:
+		*t = value
+	case *int:
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*t = v
+	case *bool:
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*t = v
+	case *int64:
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		*t = v
+	case *time.Duration:
+		v, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*t = v
+	case *[]string:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*t = items
+	default:
+		return fmt.Errorf("不支持的配置类型 %T", target)
+	}
+	return nil
+}
+
+// Validate 检查配置是否完整有效 不含只在提供服务时使用的令牌签名密钥
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Server.Listen == "" {
+		errs = append(errs, errors.New("server.listen 不能为空"))
+	}
+	if (c.Server.TLSCertFile == "") != (c.Server.TLSKeyFile == "") {
+		errs = append(errs, errors.New("server.tls_cert_file 和 server.tls_key_file 必须同时配置"))
+	}
+	for _, file := range []string{c.Server.TLSCertFile, c.Server.TLSKeyFile} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			errs = append(errs, fmt.Errorf("无法读取 TLS 文件 %s: %w", file, err))
+		}
+	}
+	if len(c.Server.AllowedOrigins) == 0 {
+		errs = append(errs, errors.New("server.allowed_origins 至少需要一个来源"))
+	}
+	switch c.Database.Driver {
+	case DriverSqlite:
+		if c.Database.Path == "" {
+			errs = append(errs, errors.New("database.path 不能为空"))
+		}
+	case DriverMysql, DriverPostgres:
+		if c.Database.Host == "" || c.Database.Name == "" || c.Database.User == "" || c.Database.Password == "" {
+			errs = append(errs, fmt.Errorf("使用 %s 时 database.host database.name database.user database.password 不能为空", c.Database.Driver))
+		}
+		if c.Database.Port <= 0 || c.Database.Port > 65535 {
+			errs = append(errs, fmt.Errorf("database.port 超出范围: %d", c.Database.Port))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("database.driver 不支持: %q 可选 mysql postgres sqlite", c.Database.Driver))
+	}
+	if c.Database.MaxOpenConns < 0 || c.Database.MaxIdleConns < 0 || c.Database.ConnMaxLifetime < 0 {
+		errs = append(errs, errors.New("数据库连接池参数不能为负数"))
+	}
+	if c.Database.MaxOpenConns > 0 && c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		errs = append(errs, errors.New("database.max_idle_conns 不能大于 database.max_open_conns"))
+	}
+	if c.Auth.TokenExpire <= 0 {
+		errs = append(errs, errors.New("auth.token_expire 必须大于0"))
+	}
+	if c.Circulation.LoanDays <= 0 {
+		errs = append(errs, errors.New("circulation.loan_days 必须大于0"))
+	}
+	if c.Circulation.RenewDays <= 0 || c.Circulation.MaxRenewals < 0 {
+		errs = append(errs, errors.New("circulation.renew_days 必须大于0 circulation.max_renewals 不能为负数"))
+	}
+	if c.Circulation.HoldPickupDays <= 0 {
+		errs = append(errs, errors.New("circulation.hold_pickup_days 必须大于0"))
+	}
+	if c.Fines.OverdueDailyCents < 0 || c.Fines.OverdueCapCents < 0 || c.Fines.LostProcessingCents < 0 || c.Fines.BlockThresholdCents < 0 {
+		errs = append(errs, errors.New("fines 中的金额不能为负数"))
+	}
+	if c.Limits.MaxCopiesPerTitle < 0 {
+		errs = append(errs, errors.New("limits.max_copies_per_title 不能为负数"))
+	}
+	for role, max := range c.Limits.MaxLoansByRole {
+		if max < 0 {
+			errs = append(errs, fmt.Errorf("limits.max_loans_by_role.%s 不能为负数", role))
+		}
+	}
+	for category, limit := range c.Limits.Categories {
+		if limit.MaxLoans < 0 || limit.MaxCopiesPerTitle < 0 {
+			errs = append(errs, fmt.Errorf("limits.categories.%s 不能为负数", category))
+		}
+	}
+	if c.Idempotency.TTL <= 0 {
+		errs = append(errs, errors.New("idempotency.ttl 必须大于0"))
+	}
+	return errors.Join(errs...)
+}
+
+// ValidateServe 在 Validate 之外检查提供服务所需的配置 迁移等维护命令不需要签名密钥
+func (c *Config) ValidateServe() error {
+	return errors.Join(c.Validate(), validateTokenSecret(c.Auth.TokenSecret))
+}
+
+// validateTokenSecret 令牌签名密钥必须由运维配置 且不能是公开过的值或过短
+func validateTokenSecret(secret string) error {
+	if secret == "" {
+		return errors.New("auth.token_secret 未配置 可通过配置文件或 BOOKMGR_TOKEN_SECRET 设置")
+	}
+	for _, public := range publicSecrets {
+		if strings.EqualFold(secret, public) {
+			return errors.New("auth.token_secret 不能使用公开的默认值")
+		}
+	}
+	if len(secret) < MinTokenSecretLength {
+		return fmt.Errorf("auth.token_secret 至少需要%d字节", MinTokenSecretLength)
+	}
+	return nil
+}
+
+// Redacted 返回隐藏了密码和密钥的配置副本
+func (c *Config) Redacted() *Config {
+	copied := *c
+	copied.Server.AllowedOrigins = append([]string(nil), c.Server.AllowedOrigins...)
+	if copied.Database.Password != "" {
+		copied.Database.Password = redacted
+	}
+	if copied.Auth.TokenSecret != "" {
+		copied.Auth.TokenSecret = redacted
+	}
+	return &copied
+}
+
+// Print 以 YAML 格式输出隐藏敏感信息后的配置
+func (c *Config) Print(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func loadWithFlags(t *testing.T, args ...string) *Config {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	conf, err := flags.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conf
+}
+
+func TestPrecedence(t *testing.T) {
+	path := writeConfig(t, "server:\n  listen: file:1\ndatabase:\n  name: file_db\n  port: 1000\nauth:\n  token_expire: 2h\n")
+	t.Setenv(configPathEnv, "")
+
+	// 配置文件覆盖默认值
+	conf := loadWithFlags(t, "-config", path)
+	if conf.Server.Listen != "file:1" || conf.Database.Name != "file_db" || conf.Auth.TokenExpire != 2*time.Hour {
+		t.Fatalf("配置文件未生效: %+v", conf)
+	}
+	if conf.Circulation.LoanDays != Default().Circulation.LoanDays {
+		t.Errorf("未配置的项应保留默认值 got %d", conf.Circulation.LoanDays)
+	}
+
+	// 环境变量覆盖配置文件
+	t.Setenv("BOOKMGR_LISTEN", "env:2")
+	t.Setenv("BOOKMGR_DB_PORT", "2000")
+	conf = loadWithFlags(t, "-config", path)
+	if conf.Server.Listen != "env:2" || conf.Database.Port != 2000 {
+		t.Fatalf("环境变量未覆盖配置文件: listen=%s port=%d", conf.Server.Listen, conf.Database.Port)
+	}
+
+	// 命令行参数覆盖环境变量 未指定的参数不影响原值
+	conf = loadWithFlags(t, "-config", path, "-listen", "flag:3")
+	if conf.Server.Listen != "flag:3" || conf.Database.Port != 2000 || conf.Database.Name != "file_db" {
+		t.Fatalf("命令行参数优先级错误: listen=%s port=%d name=%s", conf.Server.Listen, conf.Database.Port, conf.Database.Name)
+	}
+}
+
+func TestConfigPathFromEnv(t *testing.T) {
+	t.Setenv(configPathEnv, writeConfig(t, "server:\n  listen: env-file:1\n"))
+	if conf := loadWithFlags(t); conf.Server.Listen != "env-file:1" {
+		t.Errorf("未读取 %s 指定的配置文件 listen=%s", configPathEnv, conf.Server.Listen)
+	}
+}
+
+func TestInvalidEnv(t *testing.T) {
+	t.Setenv(configPathEnv, "")
+	t.Setenv("BOOKMGR_DB_PORT", "abc")
+	if _, err := Load(""); err == nil || !strings.Contains(err.Error(), "BOOKMGR_DB_PORT") {
+		t.Errorf("Load() err = %v 期望指出 BOOKMGR_DB_PORT", err)
+	}
+}
+
+func TestAllowedOriginsEnv(t *testing.T) {
+	t.Setenv(configPathEnv, "")
+	t.Setenv("BOOKMGR_ALLOWED_ORIGINS", " https://a.example , ,https://b.example")
+	conf, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(conf.Server.AllowedOrigins, "|"); got != "https://a.example|https://b.example" {
+		t.Errorf("AllowedOrigins = %q", got)
+	}
+}
+
+func TestTokenSecret(t *testing.T) {
+	cases := []struct {
+		secret string
+		ok     bool
+	}{
+		{"", false},
+		{"book-mgr-backend-secret", false},
+		{"CHANGEME", false},
+		{"short-secret", false},
+		{testSecret, true},
+	}
+	for _, c := range cases {
+		conf := Default()
+		conf.Auth.TokenSecret = c.secret
+		if err := conf.ValidateServe(); (err == nil) != c.ok {
+			t.Errorf("ValidateServe(token_secret=%q) err = %v", c.secret, err)
+		}
+	}
+}
+
+// 迁移等维护命令不签发令牌 不要求配置签名密钥
+func TestValidateWithoutSecret(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Errorf("Validate() err = %v", err)
+	}
+}
+
+func TestValidateDatabaseServer(t *testing.T) {
+	for _, driver := range []string{DriverMysql, DriverPostgres} {
+		conf := Default()
+		conf.Database.Driver = driver
+		if err := conf.Validate(); err == nil {
+			t.Errorf("%s 未配置连接信息时应校验失败", driver)
+		}
+		conf.Database.User, conf.Database.Password = "bookmgr", "db-password"
+		conf.Database.Host, conf.Database.Port, conf.Database.Name = "127.0.0.1", 3306, "bookmgr"
+		if err := conf.Validate(); err != nil {
+			t.Errorf("%s Validate() err = %v", driver, err)
+		}
+	}
+}
+
+func TestDefaultHasNoDatabaseLogin(t *testing.T) {
+	db := Default().Database
+	if db.User != "" || db.Password != "" || db.Host != "" || db.Name != "" || db.Port != 0 {
+		t.Errorf("默认配置不应包含数据库连接信息 got %+v", db)
+	}
+}
+
+func TestPoolFlags(t *testing.T) {
+	t.Setenv(configPathEnv, "")
+	conf := loadWithFlags(t, "-db-max-open-conns", "50", "-db-max-idle-conns", "5", "-db-conn-max-lifetime", "30m", "-db-ssl-mode", "require")
+	db := conf.Database
+	if db.MaxOpenConns != 50 || db.MaxIdleConns != 5 || db.ConnMaxLifetime != 30*time.Minute || db.SSLMode != "require" {
+		t.Errorf("连接池参数未生效: %+v", db)
+	}
+}
+
+func TestDefaultHasNoSecret(t *testing.T) {
+	if secret := Default().Auth.TokenSecret; secret != "" {
+		t.Errorf("默认配置不应包含签名密钥 got %q", secret)
+	}
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	conf := Default()
+	conf.Auth.TokenSecret = testSecret
+	conf.Database.Password = "db-password-in-test"
+	var out bytes.Buffer
+	if err := conf.Print(&out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), testSecret) || strings.Contains(out.String(), conf.Database.Password) {
+		t.Errorf("打印的配置中包含敏感信息:\n%s", out.String())
+	}
+	if conf.Auth.TokenSecret != testSecret || conf.Database.Password != "db-password-in-test" {
+		t.Error("Redacted 不应修改原配置")
+	}
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+)
+
+// Flags 命令行参数 优先级高于配置文件和环境变量
+type Flags struct {
+	fs          *flag.FlagSet
+	Path        string
+	PrintConfig bool
+	values      map[string]*string
+}
+
+// flagTargets 可通过命令行覆盖的配置项
+var flagTargets = map[string]struct {
+	usage  string
+	target func(c *Config) interface{}
+}{
+	"listen":               {"监听地址", func(c *Config) interface{} { return &c.Server.Listen }},
+	"tls-cert":             {"TLS 证书文件", func(c *Config) interface{} { return &c.Server.TLSCertFile }},
+	"tls-key":              {"TLS 私钥文件", func(c *Config) interface{} { return &c.Server.TLSKeyFile }},
+	"allowed-origins":      {"允许跨域的来源 以逗号分隔", func(c *Config) interface{} { return &c.Server.AllowedOrigins }},
+	"db-driver":            {"数据库驱动 mysql postgres sqlite", func(c *Config) interface{} { return &c.Database.Driver }},
+	"db-path":              {"SQLite 数据库文件路径", func(c *Config) interface{} { return &c.Database.Path }},
+	"db-user":              {"数据库用户", func(c *Config) interface{} { return &c.Database.User }},
+	"db-password":          {"数据库密码", func(c *Config) interface{} { return &c.Database.Password }},
+	"db-host":              {"数据库主机", func(c *Config) interface{} { return &c.Database.Host }},
+	"db-port":              {"数据库端口", func(c *Config) interface{} { return &c.Database.Port }},
+	"db-name":              {"数据库名", func(c *Config) interface{} { return &c.Database.Name }},
+	"db-ssl-mode":          {"PostgreSQL 的 sslmode", func(c *Config) interface{} { return &c.Database.SSLMode }},
+	"db-max-open-conns":    {"最大打开连接数 0 表示不限制", func(c *Config) interface{} { return &c.Database.MaxOpenConns }},
+	"db-max-idle-conns":    {"最大空闲连接数", func(c *Config) interface{} { return &c.Database.MaxIdleConns }},
+	"db-conn-max-lifetime": {"连接最长存活时间 如 1h 0 表示不限制", func(c *Config) interface{} { return &c.Database.ConnMaxLifetime }},
+}
+
+// RegisterFlags 在 fs 上注册配置相关的命令行参数
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	f := &Flags{fs: fs, values: map[string]*string{}}
+	fs.StringVar(&f.Path, "config", "", "YAML 配置文件路径 也可通过 "+configPathEnv+" 指定")
+	fs.BoolVar(&f.PrintConfig, "print-config", false, "打印生效的配置(隐藏敏感信息)后退出")
+	for name, item := range flagTargets {
+		f.values[name] = fs.String(name, "", item.usage)
+	}
+	return f
+}
+
+// Load 读取配置并应用命令行中显式指定的参数 需在 fs 解析之后调用
+func (f *Flags) Load() (*Config, error) {
+	conf, err := Load(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	f.fs.Visit(func(fl *flag.Flag) {
+		item, ok := flagTargets[fl.Name]
+		if !ok || err != nil {
+			return
+		}
+		if setErr := setValue(item.target(conf), *f.values[fl.Name]); setErr != nil {
+			err = fmt.Errorf("参数 -%s 的值无效: %w", fl.Name, setErr)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
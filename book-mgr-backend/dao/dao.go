@@ -1,49 +1,68 @@
 package dao
 
 import (
+	"book-mgr-backend/config"
 	"fmt"
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"log"
 )
 
-const (
-	dbUser  = "shy30"           // 使用哪个用户来连接数据库
-	dbPass  = "Passcode1!"      // 用户的密码
-	dbProto = "tcp"             // 连接的协议
-	dbHost  = "api.ikanned.com" // 数据库主机的IP或域名
-	dbPort  = 24407             // 数据库连接端口
-	dbName  = "db1"             // 操作哪一个数据库
-)
-
 var (
 	Db  *gorm.DB
 	err error
 )
 
-func InitMysqlServer() {
-	Db, err = gorm.Open(mysql.New(mysql.Config{
-		DSN: fmt.Sprintf("%s:%s@%s(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-			//remote.MyDbConfig.Username,
-			//remote.MyDbConfig.Password,
-			//remote.MyDbConfig.Protocol,
-			//remote.MyDbConfig.Host,
-			//remote.MyDbConfig.Port,
-			//remote.MyDbConfig.Database),
-			dbUser, dbPass, dbProto, dbHost, dbPort, dbName),
-		DefaultStringSize:         256,
-		DisableDatetimePrecision:  true,
-		DontSupportRenameIndex:    true,
-		DontSupportRenameColumn:   true,
-		SkipInitializeWithVersion: true,
-	}), &gorm.Config{
+// openDialector 根据配置的驱动创建对应的数据库方言
+func openDialector(dbConf config.DatabaseConfig) (gorm.Dialector, error) {
+	switch dbConf.Driver {
+	case config.DriverMysql:
+		return mysql.New(mysql.Config{
+			DSN: fmt.Sprintf("%s:%s@%s(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+				dbConf.User, dbConf.Password, dbConf.Protocol, dbConf.Host, dbConf.Port, dbConf.Name),
+			DefaultStringSize:         256,
+			DisableDatetimePrecision:  true,
+			DontSupportRenameIndex:    true,
+			DontSupportRenameColumn:   true,
+			SkipInitializeWithVersion: true,
+		}), nil
+	case config.DriverPostgres:
+		return postgres.Open(fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=%s",
+			dbConf.Host, dbConf.User, dbConf.Password, dbConf.Name, dbConf.Port, dbConf.SSLMode)), nil
+	case config.DriverSqlite:
+		// 等待写锁而不是直接返回 database is locked
+		// 事务以 BEGIN IMMEDIATE 开始 并发的写事务按顺序执行
+		return sqlite.Open(dbConf.Path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_txlock=immediate"), nil
+	default:
+		return nil, fmt.Errorf("不支持的数据库驱动: %s", dbConf.Driver)
+	}
+}
+
+func InitDatabase() {
+	dbConf := config.Conf.Database
+	dialector, err := openDialector(dbConf)
+	if err != nil {
+		log.Println("初始化数据库失败 err: ", err)
+		panic(err)
+	}
+	Db, err = gorm.Open(dialector, &gorm.Config{
 		SkipDefaultTransaction: false, // 启用事务
 	})
 	if err != nil {
 		log.Println("初始化数据库失败 err: ", err)
 		panic(err)
-	} else {
-		log.Println("初始化数据库成功")
 	}
 
+	// 连接池配置
+	sqlDb, err := Db.DB()
+	if err != nil {
+		log.Println("获取数据库连接池失败 err: ", err)
+		panic(err)
+	}
+	sqlDb.SetMaxOpenConns(dbConf.MaxOpenConns)
+	sqlDb.SetMaxIdleConns(dbConf.MaxIdleConns)
+	sqlDb.SetConnMaxLifetime(dbConf.ConnMaxLifetime)
+	log.Println("初始化数据库成功 驱动: ", dbConf.Driver)
 }
@@ -2,11 +2,16 @@ package admin
 
 import (
 	"book-mgr-backend/dao"
+	"book-mgr-backend/handler"
 	"book-mgr-backend/model"
+	"book-mgr-backend/service"
+	"errors"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 func HandleAddBook_Admin(context *gin.Context) {
@@ -16,13 +21,16 @@ func HandleAddBook_Admin(context *gin.Context) {
 		Year      int32   `json:"year"`
 		Remark    string  `json:"remark"`
 		Author    string  `json:"author"`
+		Category  string  `json:"category"`
 		ISBN      string  `json:"isbn"`
 		Price     float64 `json:"price"`
-		Residue   int64   `json:"residue"`
+		Residue   int64   `json:"residue"` // 入藏册数 按册生成条码
 		CoverUrl  string  `json:"cover_url"`
 	}{}
-	if err := context.ShouldBind(postData); err != nil {
-		log.Println(err.Error())
+	if err := context.ShouldBind(postData); err != nil || postData.Residue < 0 || postData.Residue > service.MaxCopiesPerRequest {
+		if err != nil {
+			log.Println(err.Error())
+		}
 		context.JSON(http.StatusOK, gin.H{
 			"code":    http.StatusOK,
 			"created": false,
@@ -36,12 +44,27 @@ func HandleAddBook_Admin(context *gin.Context) {
 		Year:      postData.Year,
 		Remark:    postData.Remark,
 		Author:    postData.Author,
+		Category:  postData.Category,
 		ISBN:      postData.ISBN,
 		Price:     postData.Price,
-		Residue:   postData.Residue,
 		CoverUrl:  postData.CoverUrl,
 	}
-	if err := dao.Db.Model(&model.Book{}).Create(&newBook).Error; err != nil {
+	service.FillBookPinyin(&newBook)
+	// 库存由单册状态决定 新书的每一册都单独入藏
+	if err := dao.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.Book{}).Create(&newBook).Error; err != nil {
+			return err
+		}
+		if err := service.IndexBook(tx, &newBook); err != nil {
+			return err
+		}
+		if postData.Residue == 0 {
+			return nil
+		}
+		now := time.Now()
+		_, err := service.AddCopies(tx, newBook.Id, nil, int(postData.Residue), now, now)
+		return err
+	}); err != nil {
 		log.Println(err.Error())
 		context.JSON(http.StatusOK, gin.H{
 			"code":    http.StatusInternalServerError,
@@ -65,9 +88,9 @@ func HandleUpdateBook_Admin(context *gin.Context) {
 		Year      int32   `json:"year"`
 		Remark    string  `json:"remark"`
 		Author    string  `json:"author"`
+		Category  string  `json:"category"`
 		ISBN      string  `json:"isbn"`
 		Price     float64 `json:"price"`
-		Residue   int64   `json:"residue"`
 		CoverUrl  string  `json:"cover_url"`
 	}{}
 	log.Println("查找", postData.BookId)
@@ -92,13 +115,19 @@ func HandleUpdateBook_Admin(context *gin.Context) {
 	book.Year = postData.Year
 	book.Remark = postData.Remark
 	book.Author = postData.Author
+	book.Category = postData.Category
 	book.ISBN = postData.ISBN
 	book.Price = postData.Price
-	book.Residue = postData.Residue
 	book.CoverUrl = postData.CoverUrl
+	service.FillBookPinyin(&book)
 
-	// 保存更改
-	if err := dao.Db.Save(&book).Error; err != nil {
+	// 保存更改并重建检索索引 库存随单册状态变化 不在此处修改
+	if err := dao.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("residue").Save(&book).Error; err != nil {
+			return err
+		}
+		return service.IndexBook(tx, &book)
+	}); err != nil {
 		context.JSON(http.StatusInternalServerError, gin.H{
 			"code":    http.StatusInternalServerError,
 			"msg":     "更新书籍信息失败",
@@ -117,15 +146,364 @@ func HandleUpdateBook_Admin(context *gin.Context) {
 
 func HandleDeleteBook_Admin(context *gin.Context) {
 	bookId, err := strconv.ParseInt(context.Query("id"), 10, 64)
-	if err != nil {
-		log.Println(err.Error())
+	if err != nil || bookId <= 0 {
+		context.JSON(http.StatusOK, gin.H{
+			"code": http.StatusBadRequest,
+			"msg":  "请求参数错误",
+		})
+		return
 	}
-	log.Println(bookId)
-	if result := dao.Db.Model(&model.Book{}).Where("id = ?", bookId).Delete(&model.Book{}); result.RowsAffected == 0 {
-		log.Println("删除失败")
+	if err := dao.Db.Transaction(func(tx *gorm.DB) error {
+		return service.DeleteBook(tx, bookId)
+	}); err != nil {
+		handler.RespondServiceError(context, err)
+		return
 	}
 	context.JSON(http.StatusOK, gin.H{
 		"code":    http.StatusOK,
 		"deleted": true,
 	})
 }
+
+func HandleCancelHold_Admin(context *gin.Context) {
+	holdId, err := strconv.ParseInt(context.Query("id"), 10, 64)
+	if err != nil || holdId <= 0 {
+		context.JSON(http.StatusOK, gin.H{
+			"code": http.StatusBadRequest,
+			"msg":  "请求参数错误",
+		})
+		return
+	}
+
+	// 管理员可以取消任意读者的预约
+	if err := dao.Db.Transaction(func(tx *gorm.DB) error {
+		return service.CancelHold(tx, holdId, 0, time.Now())
+	}); err != nil {
+		handler.RespondServiceError(context, err)
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{
+		"code": http.StatusOK,
+		"msg":  "已取消预约",
+	})
+}
+
+func HandleExpireHolds_Admin(context *gin.Context) {
+	// 立即清理超过取书期限的预约 不必等待定时任务
+	count, err := service.ExpireHolds(dao.Db, time.Now())
+	if err != nil {
+		context.JSON(http.StatusOK, gin.H{
+			"code": http.StatusInternalServerError,
+			"msg":  "清理过期预约失败",
+		})
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"msg":     "success",
+		"expired": count,
+	})
+}
+
+func HandleRecordFinePayment_Admin(context *gin.Context) {
+	recordFineCredit(context, model.FinePayment)
+}
+
+func HandleWaiveFine_Admin(context *gin.Context) {
+	recordFineCredit(context, model.FineWaiver)
+}
+
+// recordFineCredit 登记缴费或减免 金额单位为分
+func recordFineCredit(context *gin.Context, kind string) {
+	postData := &struct {
+		UserId    int64  `json:"user_id"`
+		HistoryId int64  `json:"history_id"`
+		Amount    int64  `json:"amount"`
+		Remark    string `json:"remark"`
+	}{}
+	if err := context.ShouldBind(postData); err != nil || postData.UserId <= 0 {
+		context.JSON(http.StatusOK, gin.H{
+			"code": http.StatusBadRequest,
+			"msg":  "请求参数错误",
+		})
+		return
+	}
+
+	operatorId := handler.GetUserIdFromContext(context)
+	var entry *model.FineEntry
+	var balance int64
+	err := dao.Db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		entry, err = service.RecordCredit(tx, kind, postData.UserId, postData.HistoryId, postData.Amount, operatorId, postData.Remark)
+		if err != nil {
+			return err
+		}
+		balance, err = service.Balance(tx, postData.UserId)
+		return err
+	})
+	if err != nil {
+		handler.RespondServiceError(context, err)
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"msg":     "success",
+		"entry":   entry,
+		"balance": balance,
+	})
+}
+
+func HandleAddCopies_Admin(context *gin.Context) {
+	postData := &struct {
+		BookId     int64    `json:"book_id"`
+		Count      int      `json:"count"`       // 自动生成条码的册数
+		Barcodes   []string `json:"barcodes"`    // 指定条码 提供时忽略 count
+		AcquiredAt string   `json:"acquired_at"` // 入藏日期 格式 2006-01-02 默认今天
+	}{}
+	if err := context.ShouldBind(postData); err != nil || postData.BookId <= 0 {
+		context.JSON(http.StatusOK, gin.H{
+			"code": http.StatusBadRequest,
+			"msg":  "请求参数错误",
+		})
+		return
+	}
+
+	acquiredAt := time.Now()
+	if postData.AcquiredAt != "" {
+		parsed, err := time.ParseInLocation(time.DateOnly, postData.AcquiredAt, time.Local)
+		if err != nil {
+			context.JSON(http.StatusOK, gin.H{
+				"code": http.StatusBadRequest,
+				"msg":  "入藏日期格式应为 2006-01-02",
+			})
+			return
+		}
+		acquiredAt = parsed
+	}
+
+	var copies []model.Copy
+	if err := dao.Db.Transaction(func(tx *gorm.DB) (err error) {
+		copies, err = service.AddCopies(tx, postData.BookId, postData.Barcodes, postData.Count, acquiredAt, time.Now())
+		return err
+	}); err != nil {
+		handler.RespondServiceError(context, err)
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{
+		"code":   http.StatusOK,
+		"msg":    "入藏成功",
+		"copies": copies,
+	})
+}
+
+func HandleUpdateCopy_Admin(context *gin.Context) {
+	postData := &struct {
+		CopyId int64   `json:"copy_id"`
+		Status string  `json:"status"`
+		Remark *string `json:"remark"`
+	}{}
+	if err := context.ShouldBind(postData); err != nil || postData.CopyId <= 0 {
+		context.JSON(http.StatusOK, gin.H{
+			"code": http.StatusBadRequest,
+			"msg":  "请求参数错误",
+		})
+		return
+	}
+
+	var item *model.Copy
+	if err := dao.Db.Transaction(func(tx *gorm.DB) (err error) {
+		if postData.Status != "" {
+			if item, err = service.ChangeCopyStatus(tx, postData.CopyId, postData.Status, time.Now()); err != nil {
+				return err
+			}
+		} else {
+			item = &model.Copy{}
+			if err := tx.First(item, postData.CopyId).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return service.ErrCopyNotFound
+				}
+				return err
+			}
+		}
+		if postData.Remark == nil {
+			return nil
+		}
+		item.Remark = *postData.Remark
+		return tx.Model(&model.Copy{}).Where("id = ?", item.Id).Update("remark", item.Remark).Error
+	}); err != nil {
+		handler.RespondServiceError(context, err)
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{
+		"code": http.StatusOK,
+		"msg":  "success",
+		"copy": item,
+	})
+}
+
+func HandleCheckout_Admin(context *gin.Context) {
+	postData := &struct {
+		Email   string `json:"email"`   // 读者邮箱
+		CardNo  string `json:"card_no"` // 借书证号 与邮箱二选一
+		BookId  int64  `json:"book_id"`
+		Barcode string `json:"barcode"` // 扫描的单册条码 提供时忽略 book_id
+	}{}
+	if err := context.ShouldBind(postData); err != nil ||
+		(postData.Email == "" && postData.CardNo == "") ||
+		(postData.BookId <= 0 && postData.Barcode == "") {
+		context.JSON(http.StatusOK, gin.H{
+			"code": http.StatusBadRequest,
+			"msg":  "请提供读者和图书",
+		})
+		return
+	}
+
+	// 服务台借出 经办人为当前登录的馆员
+	operatorId := handler.GetUserIdFromContext(context)
+	var history *model.History
+	var item *model.Copy
+	if err := dao.Db.Transaction(func(tx *gorm.DB) error {
+		patron, err := service.FindPatron(tx, postData.Email, postData.CardNo)
+		if err != nil {
+			return err
+		}
+		history, item, err = service.Checkout(tx, patron, postData.BookId, postData.Barcode, operatorId, time.Now())
+		return err
+	}); err != nil {
+		handler.RespondServiceError(context, err)
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{
+		"code":      http.StatusOK,
+		"msg":       "借出成功",
+		"borrow_id": history.BorrowId,
+		"user_id":   history.UserId,
+		"book_id":   history.BookId,
+		"barcode":   item.Barcode,
+		"due_at":    history.DueAt.Format("2006-01-02"),
+	})
+}
+
+func HandleCheckin_Admin(context *gin.Context) {
+	postData := &struct {
+		BorrowId string `json:"borrow_id"`
+		Barcode  string `json:"barcode"` // 与借阅号二选一
+	}{}
+	if err := context.ShouldBind(postData); err != nil || (postData.BorrowId == "" && postData.Barcode == "") {
+		context.JSON(http.StatusOK, gin.H{
+			"code": http.StatusBadRequest,
+			"msg":  "请提供借阅号或条码",
+		})
+		return
+	}
+
+	// 服务台可以归还任何读者的借阅
+	operatorId := handler.GetUserIdFromContext(context)
+	var history *model.History
+	var fine *model.FineEntry
+	if err := dao.Db.Transaction(func(tx *gorm.DB) (err error) {
+		if history, err = service.FindOpenLoan(tx, postData.BorrowId, postData.Barcode); err != nil {
+			return err
+		}
+		fine, err = service.ReturnLoan(tx, history, operatorId, time.Now())
+		return err
+	}); err != nil {
+		handler.RespondServiceError(context, err)
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{
+		"code":      http.StatusOK,
+		"msg":       "归还成功",
+		"borrow_id": history.BorrowId,
+		"user_id":   history.UserId,
+		"fine":      fineAmount(fine), // 本次产生的超期罚款(分)
+	})
+}
+
+// loanIncidentRequest 登记遗失或损坏时的请求 借阅号和条码二选一
+type loanIncidentRequest struct {
+	BorrowId string `json:"borrow_id"`
+	Barcode  string `json:"barcode"`
+	Charge   *int64 `json:"charge"` // 赔偿金额(分) 不提供时按书价计算
+}
+
+func HandleMarkLoanLost_Admin(context *gin.Context) {
+	postData := &loanIncidentRequest{}
+	if err := context.ShouldBind(postData); err != nil || (postData.BorrowId == "" && postData.Barcode == "") {
+		context.JSON(http.StatusOK, gin.H{
+			"code": http.StatusBadRequest,
+			"msg":  "请提供借阅号或条码",
+		})
+		return
+	}
+
+	operatorId := handler.GetUserIdFromContext(context)
+	var history *model.History
+	var charge *model.FineEntry
+	if err := dao.Db.Transaction(func(tx *gorm.DB) (err error) {
+		if history, err = service.FindOpenLoan(tx, postData.BorrowId, postData.Barcode); err != nil {
+			return err
+		}
+		charge, err = service.DeclareLost(tx, history, postData.Charge, operatorId, time.Now())
+		return err
+	}); err != nil {
+		handler.RespondServiceError(context, err)
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{
+		"code":      http.StatusOK,
+		"msg":       "已登记遗失",
+		"borrow_id": history.BorrowId,
+		"user_id":   history.UserId,
+		"charge":    fineAmount(charge), // 丢失赔偿(分)
+	})
+}
+
+func HandleReturnDamaged_Admin(context *gin.Context) {
+	postData := &loanIncidentRequest{}
+	if err := context.ShouldBind(postData); err != nil || (postData.BorrowId == "" && postData.Barcode == "") {
+		context.JSON(http.StatusOK, gin.H{
+			"code": http.StatusBadRequest,
+			"msg":  "请提供借阅号或条码",
+		})
+		return
+	}
+
+	operatorId := handler.GetUserIdFromContext(context)
+	var history *model.History
+	var fine, charge *model.FineEntry
+	if err := dao.Db.Transaction(func(tx *gorm.DB) (err error) {
+		if history, err = service.FindOpenLoan(tx, postData.BorrowId, postData.Barcode); err != nil {
+			return err
+		}
+		fine, charge, err = service.ReturnDamaged(tx, history, postData.Charge, operatorId, time.Now())
+		return err
+	}); err != nil {
+		handler.RespondServiceError(context, err)
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{
+		"code":      http.StatusOK,
+		"msg":       "已登记损坏归还",
+		"borrow_id": history.BorrowId,
+		"user_id":   history.UserId,
+		"fine":      fineAmount(fine),   // 超期罚款(分)
+		"charge":    fineAmount(charge), // 损坏赔偿(分)
+	})
+}
+
+// fineAmount 流水的金额 没有产生流水时为0
+func fineAmount(entry *model.FineEntry) int64 {
+	if entry == nil {
+		return 0
+	}
+	return entry.Amount
+}
@@ -3,8 +3,12 @@ package admin
 import (
 	"book-mgr-backend/dao"
 	"book-mgr-backend/handler"
+	"book-mgr-backend/listing"
 	"book-mgr-backend/model"
+	"book-mgr-backend/service"
+	"errors"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 	"log"
 	"net/http"
 	"strconv"
@@ -16,6 +20,8 @@ func GetAdminSummary_Admin(context *gin.Context) {
 		UserCount     int64 `json:"user_count"`
 		BookCount     int64 `json:"book_count"`
 		BorrowedCount int64 `json:"borrowed_count"`
+		LostCount     int64 `json:"lost_count"`    // 登记遗失的借阅数
+		DamagedCount  int64 `json:"damaged_count"` // 损坏归还的借阅数
 	}{}
 
 	// 查询总藏书量
@@ -45,99 +51,73 @@ func GetAdminSummary_Admin(context *gin.Context) {
 		return
 	}
 
-	// 成功
-	context.JSON(http.StatusOK, gin.H{
-		"code":    http.StatusOK,
-		"summary": responseData,
-		"msg":     "success",
-	})
-}
-
-func HandleGetAllBooks_Admin(context *gin.Context) {
-	// 获取分页参数
-	// 从查询参数中获取页码和页面大小，并检查是否有错误
-	err, page, size := handler.GetPage2SizeFormQueryParams(context)
-	if err != nil {
-		// 如果缺少分页参数，则返回错误信息
+	// 查询遗失和损坏的借阅数
+	if err := dao.Db.Model(&model.History{}).Where("outcome = ?", model.LoanLost).Count(&responseData.LostCount).Error; err != nil {
 		context.JSON(http.StatusOK, gin.H{
 			"code": http.StatusInternalServerError,
-			"msg":  "缺少查询参数",
+			"msg":  err.Error(),
 		})
 		return
 	}
-	log.Println("Page:", page, "Size:", size)
-
-	// 获取搜索和排序参数
-	// search_by: 要搜索的字段（如 name, author, publisher），对应数据库中的列名
-	searchBy := context.Query("search_by")
-	// search_content: 搜索内容，即实际的搜索值
-	searchContent := context.Query("search_content")
-	// search_sort: 排序方式，如 "ASC" 或 "DESC"
-	searchSort := context.Query("search_sort")
-
-	// 获取总记录数
-	// 查询书籍的总记录数，以便用于计算分页
-	var totalBooks int64
-	if result := dao.Db.Model(&model.Book{}).Count(&totalBooks); result.Error != nil {
-		// 如果查询总记录数出错，则返回错误信息
+	if err := dao.Db.Model(&model.History{}).Where("outcome = ?", model.LoanDamaged).Count(&responseData.DamagedCount).Error; err != nil {
 		context.JSON(http.StatusOK, gin.H{
 			"code": http.StatusInternalServerError,
-			"msg":  "查询总记录数出错",
+			"msg":  err.Error(),
 		})
 		return
 	}
 
-	// 计算总页数
-	// 根据总记录数和页面大小计算总页数，用于返回给客户端
-	pageCount := (totalBooks + int64(size) - 1) / int64(size)
-
-	// 查询分页数据
-	// 根据分页参数计算偏移量，并查询数据库中的书籍信息
-	var books []model.Book
-	offset := (page - 1) * size
-	query := dao.Db.Model(&model.Book{}).Offset(int(offset)).Limit(int(size))
+	// 成功
+	context.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"summary": responseData,
+		"msg":     "success",
+	})
+}
 
-	// 如果指定了搜索条件，则添加过滤条件
-	if searchBy != "" && searchContent != "" {
-		query = query.Where(searchBy+" LIKE ?", "%"+searchContent+"%")
-	}
+// HandleSuggestBooks_Admin 书名 作者和出版社的输入联想
+func HandleSuggestBooks_Admin(context *gin.Context) {
+	handler.RespondBookSuggestions(context)
+}
 
-	// 如果指定了排序方式，则添加排序条件
-	if searchSort != "" {
-		query = query.Order("`" + searchBy + "` " + searchSort)
+func HandleGetAllBooks_Admin(context *gin.Context) {
+	// 获取分页参数
+	// 从查询参数中获取页码和页面大小 页面大小有上限 提供 cursor 时按游标翻页
+	list, err := handler.NewList(context, listing.DefaultPageSize)
+	if err != nil {
+		handler.RespondListError(context, err)
+		return
 	}
+	log.Println("Page:", list.Page, "Size:", list.Size)
 
-	// 执行查询
-	if result := query.Find(&books); result.Error != nil {
-		// 如果查询出错，则返回错误信息
-		context.JSON(http.StatusOK, gin.H{
-			"code": http.StatusInternalServerError,
-			"msg":  "查询出错",
-		})
+	// 查询分页数据
+	// 添加搜索 筛选和排序条件 总数与分页使用相同的条件 字段只能取白名单中的值
+	result, err := handler.FindBooks(context, list)
+	if err != nil {
+		handler.RespondListError(context, err)
 		return
 	}
 
-	// 返回分页数据和总页数
-	// 返回书籍列表、总页数和总记录数给客户端
-	context.JSON(http.StatusOK, gin.H{
-		"code":        http.StatusOK,
-		"books":       books,
-		"page_count":  pageCount,
-		"total_books": totalBooks,
-	})
+	// 返回书籍列表和分页信息
+	context.JSON(http.StatusOK, handler.ListBody(result.Envelope, gin.H{
+		"code":         http.StatusOK,
+		"books":        result.Books,
+		"total_books":  result.Envelope.Total,
+		"did_you_mean": result.DidYouMean, // 原查询没有结果时实际使用的纠错建议
+		"facets":       result.Facets,
+	}))
 }
 
 func HandleGetAllUsers_Admin(context *gin.Context) {
 	// 从请求参数中获取分页和筛选条件
-	page := context.DefaultQuery("page", "1")
-	size := context.DefaultQuery("size", "100")
+	list, err := handler.NewList(context, listing.MaxPageSize)
+	if err != nil {
+		handler.RespondListError(context, err)
+		return
+	}
 	searchEmail := context.DefaultQuery("search_email", "")
 
-	// 转换分页参数
-	pageInt, _ := strconv.Atoi(page)
-	sizeInt, _ := strconv.Atoi(size)
-
-	// 创建查询链以筛选用户
+	// 创建查询链以筛选用户 总数与分页使用同一组条件
 	var users []model.User
 	query := dao.Db.Model(&model.User{}).Where("deleted_at IS NULL")
 
@@ -146,10 +126,14 @@ func HandleGetAllUsers_Admin(context *gin.Context) {
 		query = query.Where("email LIKE ?", "%"+searchEmail+"%")
 	}
 
-	// 分页查询用户
-	err := query.Offset((pageInt - 1) * sizeInt).Limit(sizeInt).Find(&users).Error
+	// 按id排序分页查询用户
+	list.Query = query
+	list.Keyset = listing.NewKeyset(nil, listing.Order{Column: "id"})
+	envelope, err := listing.Fetch(list, &users, func(user *model.User) []interface{} {
+		return []interface{}{user.Id}
+	})
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "查询用户失败", "error": err.Error()})
+		handler.RespondListError(context, err)
 		return
 	}
 
@@ -186,54 +170,53 @@ func HandleGetAllUsers_Admin(context *gin.Context) {
 		})
 	}
 
-	// 计算总用户数，用于前端分页
-	var totalUsers int64
-	err = dao.Db.Model(&model.User{}).Where("deleted_at IS NULL").Count(&totalUsers).Error
-	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户总数失败", "error": err.Error()})
-		return
-	}
-
 	// 返回分页数据和用户列表
-	context.JSON(http.StatusOK, gin.H{
-		"code":       200,
-		"users":      responseUsers,
-		"page_count": (totalUsers + int64(sizeInt) - 1) / int64(sizeInt), // 计算页数
-	})
+	context.JSON(http.StatusOK, handler.ListBody(envelope, gin.H{
+		"code":  200,
+		"users": responseUsers,
+	}))
 }
 
 type BorrowHistory struct {
-	Id        int64  `json:"id"`
-	BorrowId  string `json:"borrow_id"`
-	Email     string `json:"email"`
-	BookName  string `json:"book_name"`
-	BookISBN  string `json:"book_isbn"`
-	CreatedAt string `json:"created_at"`
-	IsBack    bool   `json:"is_back"`
+	Id          int64  `json:"id"`
+	BorrowId    string `json:"borrow_id"`
+	Email       string `json:"email"`
+	BookName    string `json:"book_name"`
+	BookISBN    string `json:"book_isbn"`
+	CreatedAt   string `json:"created_at"`
+	DueAt       string `json:"due_at"`
+	IsBack      bool   `json:"is_back"`
+	Overdue     bool   `json:"overdue"`
+	DaysOverdue int64  `json:"days_overdue"`
 }
 
 func GetAllHistories_Admin(context *gin.Context) {
 	// 获取分页和搜索条件
-	page, _ := strconv.Atoi(context.DefaultQuery("page", "1"))
-	size, _ := strconv.Atoi(context.DefaultQuery("size", "10"))
+	list, err := handler.NewList(context, listing.DefaultPageSize)
+	if err != nil {
+		handler.RespondListError(context, err)
+		return
+	}
 	searchType := context.DefaultQuery("search_type", "")
 	searchTarget := context.DefaultQuery("search_target", "")
 
-	var results []struct {
-		Id        int64     `json:"id"`
-		BorrowId  string    `json:"borrow_id"`
-		Email     string    `json:"email"`
-		BookName  string    `json:"book_name"`
-		BookISBN  string    `json:"book_isbn"`
-		CreatedAt time.Time `json:"created_at"`
-		IsBack    bool      `json:"is_back"`
+	type historyRow struct {
+		Id        int64      `json:"id"`
+		BorrowId  string     `json:"borrow_id"`
+		Email     string     `json:"email"`
+		BookName  string     `json:"book_name"`
+		BookISBN  string     `json:"book_isbn"`
+		CreatedAt time.Time  `json:"created_at"`
+		DueAt     *time.Time `json:"due_at"`
+		IsBack    bool       `json:"is_back"`
 	}
+	var results []historyRow
 
-	// 初始化查询，关联用户和书籍表
+	// 初始化查询，关联用户和书籍表 不含已删除的借阅记录
 	query := dao.Db.Table("t_history").
-		Select("t_history.id, t_history.borrow_id, t_user.email, t_books.name AS book_name, t_books.isbn AS book_isbn, t_history.created_at, t_history.is_back").
 		Joins("JOIN t_user ON t_user.id = t_history.user_id").
-		Joins("JOIN t_books ON t_books.id = t_history.book_id")
+		Joins("JOIN t_books ON t_books.id = t_history.book_id").
+		Where("t_history.deleted_at IS NULL")
 
 	// 根据 searchType 和 searchTarget 添加查询条件
 	if searchTarget != "" {
@@ -247,51 +230,466 @@ func GetAllHistories_Admin(context *gin.Context) {
 		}
 	}
 
-	// 计算总记录数
-	var totalRecords int64
-	if err := query.Count(&totalRecords).Error; err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{
+	// 统计总数并分页查询 借阅时间相同时按id排序
+	list.Query = query
+	list.Select = func(db *gorm.DB) *gorm.DB {
+		return db.Select("t_history.id, t_history.borrow_id, t_user.email, t_books.name AS book_name, t_books.isbn AS book_isbn, t_history.created_at, t_history.due_at, t_history.is_back")
+	}
+	list.Keyset = listing.NewKeyset(
+		[]listing.Order{{Column: "t_history.created_at", Desc: true}},
+		listing.Order{Column: "t_history.id", Desc: true},
+	)
+	envelope, err := listing.Fetch(list, &results, func(row *historyRow) []interface{} {
+		return []interface{}{row.CreatedAt, row.Id}
+	})
+	if err != nil {
+		handler.RespondListError(context, err)
+		return
+	}
+
+	// 转换查询结果为前端需要的格式
+	now := time.Now()
+	var borrowHistories []BorrowHistory
+	for _, result := range results {
+		history := model.History{DueAt: result.DueAt, IsBack: result.IsBack}
+		dueAt := ""
+		if result.DueAt != nil {
+			dueAt = result.DueAt.Format("2006-01-02")
+		}
+		borrowHistories = append(borrowHistories, BorrowHistory{
+			Id:          result.Id,
+			BorrowId:    result.BorrowId,
+			Email:       result.Email,
+			BookName:    result.BookName,
+			BookISBN:    result.BookISBN,
+			CreatedAt:   result.CreatedAt.Format("2006-01-02 15:04:05"),
+			DueAt:       dueAt,
+			IsBack:      result.IsBack,
+			Overdue:     history.IsOverdue(now),
+			DaysOverdue: history.DaysOverdue(now),
+		})
+	}
+
+	// 返回查询结果和总页数
+	context.JSON(http.StatusOK, handler.ListBody(envelope, gin.H{
+		"code":      http.StatusOK,
+		"histories": borrowHistories,
+		"msg":       "success",
+	}))
+}
+
+type LoanDetail struct {
+	Id          int64  `json:"id"`
+	BorrowId    string `json:"borrow_id"`
+	UserId      int64  `json:"user_id"`
+	Email       string `json:"email"`
+	BookId      int64  `json:"book_id"`
+	BookName    string `json:"book_name"`
+	BookISBN    string `json:"book_isbn"`
+	CopyId      int64  `json:"copy_id"`
+	Barcode     string `json:"barcode"`
+	BorrowedAt  string `json:"borrowed_at"`
+	DueAt       string `json:"due_at"`
+	IsBack      bool   `json:"is_back"`
+	ReturnedAt  string `json:"returned_at"`
+	Outcome     string `json:"outcome"`
+	RenewCount  int    `json:"renew_count"`
+	Overdue     bool   `json:"overdue"`
+	DaysOverdue int64  `json:"days_overdue"`
+}
+
+func HandleLookupLoan_Admin(context *gin.Context) {
+	if context.Query("borrow_id") == "" {
+		context.JSON(http.StatusOK, gin.H{
+			"code": http.StatusBadRequest,
+			"msg":  "请提供借阅号",
+		})
+		return
+	}
+	// 新格式的借阅号先核对校验码 录入错误时直接提示 旧格式按原样查找
+	borrowId, err := service.ParseBorrowId(context.Query("borrow_id"))
+	if err != nil {
+		handler.RespondServiceError(context, err)
+		return
+	}
+
+	var history model.History
+	if err := dao.Db.Preload("Book").Where("borrow_id = ?", borrowId).First(&history).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			context.JSON(http.StatusOK, gin.H{
+				"code": http.StatusNotFound,
+				"msg":  "借阅记录不存在",
+			})
+			return
+		}
+		context.JSON(http.StatusOK, gin.H{
 			"code": http.StatusInternalServerError,
-			"msg":  "Failed to count histories",
+			"msg":  "查询借阅记录失败",
 		})
 		return
 	}
 
-	// 计算 page_count
-	pageCount := (totalRecords + int64(size) - 1) / int64(size)
+	var user model.User
+	dao.Db.Unscoped().Select("id", "email").First(&user, history.UserId)
+	var item model.Copy
+	dao.Db.Unscoped().Select("id", "barcode").First(&item, history.CopyId)
+
+	now := time.Now()
+	loan := LoanDetail{
+		Id:          history.Id,
+		BorrowId:    history.BorrowId,
+		UserId:      history.UserId,
+		Email:       user.Email,
+		BookId:      history.BookId,
+		BookName:    history.Book.Name,
+		BookISBN:    history.Book.ISBN,
+		CopyId:      history.CopyId,
+		Barcode:     item.Barcode,
+		IsBack:      history.IsBack,
+		Outcome:     history.Outcome,
+		RenewCount:  history.RenewCount,
+		Overdue:     history.IsOverdue(now),
+		DaysOverdue: history.DaysOverdue(now),
+	}
+	if history.BorrowedAt != nil {
+		loan.BorrowedAt = history.BorrowedAt.Format("2006-01-02 15:04:05")
+	}
+	if history.DueAt != nil {
+		loan.DueAt = history.DueAt.Format("2006-01-02 15:04:05")
+	}
+	if history.ReturnedAt != nil {
+		loan.ReturnedAt = history.ReturnedAt.Format("2006-01-02 15:04:05")
+	}
 
-	// 执行分页和排序
-	offset := (page - 1) * size
-	query = query.Order("t_history.created_at DESC").Offset(offset).Limit(size)
+	context.JSON(http.StatusOK, gin.H{
+		"code": http.StatusOK,
+		"loan": loan,
+		"msg":  "success",
+	})
+}
 
-	// 获取分页数据
-	if err := query.Scan(&results).Error; err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{
-			"code": http.StatusInternalServerError,
-			"msg":  "Failed to retrieve histories",
+type OverdueLoan struct {
+	Id          int64  `json:"id"`
+	BorrowId    string `json:"borrow_id"`
+	UserId      int64  `json:"user_id"`
+	Email       string `json:"email"`
+	BookId      int64  `json:"book_id"`
+	BookName    string `json:"book_name"`
+	BookISBN    string `json:"book_isbn"`
+	BorrowedAt  string `json:"borrowed_at"`
+	DueAt       string `json:"due_at"`
+	DaysOverdue int64  `json:"days_overdue"`
+}
+
+func HandleGetOverdueLoans_Admin(context *gin.Context) {
+	// 获取分页和筛选条件
+	list, err := handler.NewList(context, listing.DefaultPageSize)
+	if err != nil {
+		handler.RespondListError(context, err)
+		return
+	}
+	userId, _ := strconv.ParseInt(context.DefaultQuery("user_id", "0"), 10, 64)
+	bookId, _ := strconv.ParseInt(context.DefaultQuery("book_id", "0"), 10, 64)
+
+	type overdueRow struct {
+		Id         int64
+		BorrowId   string
+		UserId     int64
+		Email      string
+		BookId     int64
+		BookName   string
+		BookISBN   string
+		BorrowedAt *time.Time
+		DueAt      *time.Time
+	}
+	var results []overdueRow
+
+	// 未归还且已过应还日期的借阅记录
+	now := time.Now()
+	query := dao.Db.Table("t_history").
+		Joins("JOIN t_user ON t_user.id = t_history.user_id").
+		Joins("JOIN t_books ON t_books.id = t_history.book_id").
+		Where("t_history.deleted_at IS NULL AND t_history.is_back = ? AND t_history.due_at < ?", false, now)
+	if userId > 0 {
+		query = query.Where("t_history.user_id = ?", userId)
+	}
+	if bookId > 0 {
+		query = query.Where("t_history.book_id = ?", bookId)
+	}
+
+	// 超期最久的排在前面
+	list.Query = query
+	list.Select = func(db *gorm.DB) *gorm.DB {
+		return db.Select("t_history.id, t_history.borrow_id, t_history.user_id, t_user.email, t_history.book_id, t_books.name AS book_name, t_books.isbn AS book_isbn, t_history.borrowed_at, t_history.due_at")
+	}
+	list.Keyset = listing.NewKeyset(
+		[]listing.Order{{Column: "t_history.due_at"}},
+		listing.Order{Column: "t_history.id"},
+	)
+	envelope, err := listing.Fetch(list, &results, func(row *overdueRow) []interface{} {
+		return []interface{}{*row.DueAt, row.Id}
+	})
+	if err != nil {
+		handler.RespondListError(context, err)
+		return
+	}
+
+	loans := make([]OverdueLoan, 0, len(results))
+	for _, result := range results {
+		history := model.History{DueAt: result.DueAt}
+		loans = append(loans, OverdueLoan{
+			Id:          result.Id,
+			BorrowId:    result.BorrowId,
+			UserId:      result.UserId,
+			Email:       result.Email,
+			BookId:      result.BookId,
+			BookName:    result.BookName,
+			BookISBN:    result.BookISBN,
+			BorrowedAt:  result.BorrowedAt.Format("2006-01-02 15:04:05"),
+			DueAt:       result.DueAt.Format("2006-01-02 15:04:05"),
+			DaysOverdue: history.DaysOverdue(now),
 		})
+	}
+
+	context.JSON(http.StatusOK, handler.ListBody(envelope, gin.H{
+		"code":  http.StatusOK,
+		"loans": loans,
+		"msg":   "success",
+	}))
+}
+
+type HoldQueueItem struct {
+	Id        int64  `json:"id"`
+	UserId    int64  `json:"user_id"`
+	Email     string `json:"email"`
+	BookId    int64  `json:"book_id"`
+	BookName  string `json:"book_name"`
+	Status    string `json:"status"`
+	ExpiresAt string `json:"expires_at"`
+	CreatedAt string `json:"created_at"`
+}
+
+func HandleGetHolds_Admin(context *gin.Context) {
+	list, err := handler.NewList(context, listing.DefaultPageSize)
+	if err != nil {
+		handler.RespondListError(context, err)
 		return
 	}
+	bookId, _ := strconv.ParseInt(context.DefaultQuery("book_id", "0"), 10, 64)
+	userId, _ := strconv.ParseInt(context.DefaultQuery("user_id", "0"), 10, 64)
+	// 默认查看排队中和待取书的预约
+	status := context.DefaultQuery("status", "active")
+
+	type holdRow struct {
+		Id        int64
+		UserId    int64
+		Email     string
+		BookId    int64
+		BookName  string
+		Status    string
+		ExpiresAt *time.Time
+		CreatedAt time.Time
+	}
+	var results []holdRow
+
+	query := dao.Db.Table("t_hold").
+		Joins("JOIN t_user ON t_user.id = t_hold.user_id").
+		Joins("JOIN t_books ON t_books.id = t_hold.book_id").
+		Where("t_hold.deleted_at IS NULL")
+	if status == "active" {
+		query = query.Where("t_hold.status IN ?", []string{model.HoldWaiting, model.HoldReady})
+	} else if status != "all" {
+		query = query.Where("t_hold.status = ?", status)
+	}
+	if bookId > 0 {
+		query = query.Where("t_hold.book_id = ?", bookId)
+	}
+	if userId > 0 {
+		query = query.Where("t_hold.user_id = ?", userId)
+	}
 
-	// 转换查询结果为前端需要的格式
-	var borrowHistories []BorrowHistory
+	// 按图书分组 同一本书按排队先后排列
+	list.Query = query
+	list.Select = func(db *gorm.DB) *gorm.DB {
+		return db.Select("t_hold.id, t_hold.user_id, t_user.email, t_hold.book_id, t_books.name AS book_name, t_hold.status, t_hold.expires_at, t_hold.created_at")
+	}
+	list.Keyset = listing.NewKeyset(
+		[]listing.Order{{Column: "t_hold.book_id"}},
+		listing.Order{Column: "t_hold.id"},
+	)
+	envelope, err := listing.Fetch(list, &results, func(row *holdRow) []interface{} {
+		return []interface{}{row.BookId, row.Id}
+	})
+	if err != nil {
+		handler.RespondListError(context, err)
+		return
+	}
+
+	holds := make([]HoldQueueItem, 0, len(results))
 	for _, result := range results {
-		borrowHistories = append(borrowHistories, BorrowHistory{
+		expiresAt := ""
+		if result.ExpiresAt != nil {
+			expiresAt = result.ExpiresAt.Format("2006-01-02 15:04:05")
+		}
+		holds = append(holds, HoldQueueItem{
 			Id:        result.Id,
-			BorrowId:  result.BorrowId,
+			UserId:    result.UserId,
 			Email:     result.Email,
+			BookId:    result.BookId,
 			BookName:  result.BookName,
-			BookISBN:  result.BookISBN,
+			Status:    result.Status,
+			ExpiresAt: expiresAt,
 			CreatedAt: result.CreatedAt.Format("2006-01-02 15:04:05"),
-			IsBack:    result.IsBack,
 		})
 	}
 
-	// 返回查询结果和总页数
-	context.JSON(http.StatusOK, gin.H{
-		"code":       http.StatusOK,
-		"histories":  borrowHistories,
-		"msg":        "success",
-		"page_count": pageCount,
+	context.JSON(http.StatusOK, handler.ListBody(envelope, gin.H{
+		"code":  http.StatusOK,
+		"holds": holds,
+		"msg":   "success",
+	}))
+}
+
+type CopyItem struct {
+	Id         int64  `json:"id"`
+	BookId     int64  `json:"book_id"`
+	BookName   string `json:"book_name"`
+	Barcode    string `json:"barcode"`
+	Status     string `json:"status"`
+	AcquiredAt string `json:"acquired_at"`
+	Remark     string `json:"remark"`
+	BorrowId   string `json:"borrow_id"` // 借出时的借阅号
+	Email      string `json:"email"`     // 借出时的借阅人
+}
+
+func HandleGetCopies_Admin(context *gin.Context) {
+	list, err := handler.NewList(context, listing.DefaultPageSize)
+	if err != nil {
+		handler.RespondListError(context, err)
+		return
+	}
+	bookId, _ := strconv.ParseInt(context.DefaultQuery("book_id", "0"), 10, 64)
+	status := context.Query("status")
+	barcode := context.Query("barcode")
+
+	type copyRow struct {
+		Id         int64
+		BookId     int64
+		BookName   string
+		Barcode    string
+		Status     string
+		AcquiredAt *time.Time
+		Remark     string
+		BorrowId   *string
+		Email      *string
+	}
+	var results []copyRow
+
+	// 借出的单册带上当前的借阅记录 便于盘点时核对
+	query := dao.Db.Table("t_copy").
+		Joins("JOIN t_books ON t_books.id = t_copy.book_id").
+		Joins("LEFT JOIN t_history ON t_history.copy_id = t_copy.id AND t_history.is_back = ? AND t_history.deleted_at IS NULL", false).
+		Joins("LEFT JOIN t_user ON t_user.id = t_history.user_id").
+		Where("t_copy.deleted_at IS NULL")
+	if bookId > 0 {
+		query = query.Where("t_copy.book_id = ?", bookId)
+	}
+	if status != "" {
+		query = query.Where("t_copy.status = ?", status)
+	}
+	if barcode != "" {
+		query = query.Where("t_copy.barcode = ?", barcode)
+	}
+
+	list.Query = query
+	list.Select = func(db *gorm.DB) *gorm.DB {
+		return db.Select("t_copy.id, t_copy.book_id, t_books.name AS book_name, t_copy.barcode, t_copy.status, t_copy.acquired_at, t_copy.remark, t_history.borrow_id, t_user.email")
+	}
+	list.Keyset = listing.NewKeyset(
+		[]listing.Order{{Column: "t_copy.book_id"}},
+		listing.Order{Column: "t_copy.id"},
+	)
+	envelope, err := listing.Fetch(list, &results, func(row *copyRow) []interface{} {
+		return []interface{}{row.BookId, row.Id}
 	})
+	if err != nil {
+		handler.RespondListError(context, err)
+		return
+	}
+
+	copies := make([]CopyItem, 0, len(results))
+	for _, result := range results {
+		item := CopyItem{
+			Id:       result.Id,
+			BookId:   result.BookId,
+			BookName: result.BookName,
+			Barcode:  result.Barcode,
+			Status:   result.Status,
+			Remark:   result.Remark,
+		}
+		if result.AcquiredAt != nil {
+			item.AcquiredAt = result.AcquiredAt.Format("2006-01-02")
+		}
+		if result.BorrowId != nil {
+			item.BorrowId = *result.BorrowId
+		}
+		if result.Email != nil {
+			item.Email = *result.Email
+		}
+		copies = append(copies, item)
+	}
+
+	context.JSON(http.StatusOK, handler.ListBody(envelope, gin.H{
+		"code":   http.StatusOK,
+		"copies": copies,
+		"msg":    "success",
+	}))
+}
+
+func HandleGetFines_Admin(context *gin.Context) {
+	list, err := handler.NewList(context, listing.DefaultPageSize)
+	if err != nil {
+		handler.RespondListError(context, err)
+		return
+	}
+	userId, _ := strconv.ParseInt(context.DefaultQuery("user_id", "0"), 10, 64)
+	kind := context.Query("kind")
+
+	query := dao.Db.Model(&model.FineEntry{})
+	if userId > 0 {
+		query = query.Where("user_id = ?", userId)
+	}
+	if kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+
+	var entries []model.FineEntry
+	list.Query = query
+	list.Keyset = listing.NewKeyset(nil, listing.Order{Column: "id", Desc: true})
+	envelope, err := listing.Fetch(list, &entries, func(entry *model.FineEntry) []interface{} {
+		return []interface{}{entry.Id}
+	})
+	if err != nil {
+		handler.RespondListError(context, err)
+		return
+	}
+
+	response := handler.ListBody(envelope, gin.H{
+		"code":    http.StatusOK,
+		"entries": entries,
+		"msg":     "success",
+	})
+	// 指定用户时同时返回其欠款
+	if userId > 0 {
+		balance, err := service.Balance(dao.Db, userId)
+		if err != nil {
+			context.JSON(http.StatusOK, gin.H{
+				"code": http.StatusInternalServerError,
+				"msg":  "查询欠款失败",
+			})
+			return
+		}
+		response["balance"] = balance
+	}
+	context.JSON(http.StatusOK, response)
 }
@@ -0,0 +1,384 @@
+package handler
+
+import (
+	"book-mgr-backend/dao"
+	"book-mgr-backend/listing"
+	"book-mgr-backend/model"
+	"book-mgr-backend/search"
+	"book-mgr-backend/service"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/http"
+	"strconv"
+)
+
+// BookFields 书籍列表开放的搜索和排序字段
+var BookFields = listing.Fields{
+	"id":         {Column: "id", Sortable: true},
+	"name":       {Column: "name", Searchable: true, Sortable: true},
+	"author":     {Column: "author", Searchable: true, Sortable: true},
+	"publisher":  {Column: "publisher", Searchable: true, Sortable: true},
+	"isbn":       {Column: "isbn", Searchable: true, Sortable: true},
+	"category":   {Column: "category", Searchable: true, Sortable: true},
+	"remark":     {Column: "remark", Searchable: true},
+	"year":       {Column: "year", Sortable: true},
+	"price":      {Column: "price", Sortable: true},
+	"residue":    {Column: "residue", Sortable: true},
+	"created_at": {Column: "created_at", Sortable: true},
+}
+
+// bookPinyinColumns 支持拼音匹配的列 对应的全拼列和首字母列
+var bookPinyinColumns = map[string][2]string{
+	"name":   {"name_pinyin", "name_initials"},
+	"author": {"author_pinyin", "author_initials"},
+}
+
+// BookHit 书籍列表中的一项 全文检索时附带得分和命中片段
+type BookHit struct {
+	model.Book
+	Score      int64             `json:"score,omitempty"`
+	Highlights map[string]string `json:"highlights,omitempty" gorm:"-"` // 字段名到高亮片段
+}
+
+// remark 较长 只截取命中附近的内容
+const remarkSnippetWidth = 60
+
+// BookResult 一页书籍及附带信息
+type BookResult struct {
+	Books      []BookHit
+	Envelope   *listing.Envelope
+	DidYouMean *service.Suggestion // 原查询没有结果时实际使用的纠错建议
+	Facets     *service.BookFacets // 请求 facets=true 时返回
+}
+
+// FindBooks 查询一页书籍 总数与分页使用相同的检索和筛选条件
+// 第一页没有结果且检索词本身就查不到书时 改用与检索词最相近的书名 作者或出版社检索
+func FindBooks(context *gin.Context, list *listing.List) (*BookResult, error) {
+	params, err := parseBookQuery(context)
+	if err != nil {
+		return nil, err
+	}
+	withFacets, err := listing.ParseBool("facets", context.Query("facets"))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BookResult{}
+	terms, envelope, err := params.find(list, &result.Books)
+	if err != nil {
+		return nil, err
+	}
+	if envelope.Total == 0 && list.Page == 1 && list.Cursor == "" {
+		if result.DidYouMean, err = params.correct(); err != nil {
+			return nil, err
+		}
+		if result.DidYouMean != nil {
+			if terms, envelope, err = params.find(list, &result.Books); err != nil {
+				return nil, err
+			}
+		}
+	}
+	result.Envelope = envelope
+	HighlightBooks(result.Books, terms)
+
+	if withFacets != nil && *withFacets {
+		if result.Facets, err = params.facets(); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// RespondBookSuggestions 返回输入联想 q 为已输入的内容 limit 为最多返回的条数
+func RespondBookSuggestions(context *gin.Context) {
+	limit, _ := strconv.Atoi(context.DefaultQuery("limit", "10"))
+	suggestions, err := service.SuggestBooks(dao.Db, context.Query("q"), limit)
+	if err != nil {
+		RespondServiceError(context, err)
+		return
+	}
+	context.JSON(http.StatusOK, gin.H{
+		"code":        http.StatusOK,
+		"suggestions": suggestions,
+	})
+}
+
+// bookQuery 书籍列表的查询参数 解析一次后供分页查询和分面统计共用
+type bookQuery struct {
+	q             string
+	searchColumn  string
+	searchContent string
+	filter        *service.BookFilter
+	orders        []listing.Order
+}
+
+// parseBookQuery 解析书籍列表的查询参数
+// q 为全文检索 同时检索标题 作者 出版社 分类 ISBN 和简介 未指定排序时按相关度排序
+// search_by + search_content 为单字段模糊搜索
+// sort 为多字段排序 如 sort=year:desc,name 未提供时沿用 search_sort 对 search_by 排序
+// publisher author category 可重复传入多个取值 year_min year_max 含两端
+// price_min 含 price_max 不含 available=true 只看有在架册的书
+func parseBookQuery(context *gin.Context) (*bookQuery, error) {
+	params := &bookQuery{
+		q:      context.Query("q"),
+		filter: &service.BookFilter{},
+	}
+	searchBy := context.Query("search_by")
+	searchSort := context.Query("search_sort")
+
+	if content := context.Query("search_content"); searchBy != "" && content != "" {
+		column, err := BookFields.SearchColumn("search_by", searchBy)
+		if err != nil {
+			return nil, err
+		}
+		params.searchColumn, params.searchContent = column, content
+	}
+
+	filter := params.filter
+	filter.Publishers = context.QueryArray("publisher")
+	filter.Authors = context.QueryArray("author")
+	filter.Categories = context.QueryArray("category")
+	var err error
+	if filter.YearMin, err = listing.ParseInt("year_min", context.Query("year_min")); err != nil {
+		return nil, err
+	}
+	if filter.YearMax, err = listing.ParseInt("year_max", context.Query("year_max")); err != nil {
+		return nil, err
+	}
+	if filter.PriceMin, err = listing.ParseFloat("price_min", context.Query("price_min")); err != nil {
+		return nil, err
+	}
+	if filter.PriceMax, err = listing.ParseFloat("price_max", context.Query("price_max")); err != nil {
+		return nil, err
+	}
+	if filter.Available, err = listing.ParseBool("available", context.Query("available")); err != nil {
+		return nil, err
+	}
+	if err = filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	if params.orders, err = BookFields.ParseSort("sort", context.Query("sort")); err != nil {
+		return nil, err
+	}
+	if len(params.orders) == 0 && searchSort != "" && searchBy != "" {
+		desc, err := listing.ParseDirection("search_sort", searchSort)
+		if err != nil {
+			return nil, err
+		}
+		if params.orders, err = BookFields.ParseSort("search_by", searchBy); err != nil {
+			return nil, err
+		}
+		for i := range params.orders {
+			params.orders[i].Desc = desc
+		}
+	}
+	return params, nil
+}
+
+// scope 添加检索和筛选条件 skip 为统计分面时跳过的分面 返回相关度表达式和高亮词项
+func (params *bookQuery) scope(query *gorm.DB, skip string) (*gorm.DB, *clause.Expr, []string, error) {
+	query, score, terms, err := params.search(query)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return params.filter.Apply(query, skip), score, terms, nil
+}
+
+// search 只添加 q 和 search_content 的检索条件 不含筛选
+func (params *bookQuery) search(query *gorm.DB) (*gorm.DB, *clause.Expr, []string, error) {
+	query, score, terms, err := params.searchText(query)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return params.searchField(query), score, terms, nil
+}
+
+// searchText 添加 q 的全文检索条件
+func (params *bookQuery) searchText(query *gorm.DB) (*gorm.DB, *clause.Expr, []string, error) {
+	if params.q == "" {
+		return query, nil, nil, nil
+	}
+	query, score, terms, err := service.ApplyBookSearch(query, params.q)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return query, &score, terms, nil
+}
+
+// searchField 添加 search_by + search_content 的单字段模糊搜索条件
+func (params *bookQuery) searchField(query *gorm.DB) *gorm.DB {
+	if params.searchColumn == "" {
+		return query
+	}
+	column, content := params.searchColumn, params.searchContent
+	// 书名和作者同时按拼音全拼和首字母匹配
+	pinyinColumns, hasPinyin := bookPinyinColumns[column]
+	if key, isPinyin := search.PinyinQuery(content); hasPinyin && isPinyin {
+		return query.Where("t_books."+column+" LIKE ? OR t_books."+pinyinColumns[0]+" LIKE ? OR t_books."+pinyinColumns[1]+" LIKE ?",
+			"%"+content+"%", "%"+key+"%", "%"+key+"%")
+	}
+	return query.Where("t_books."+column+" LIKE ?", "%"+content+"%")
+}
+
+// correct 检索词本身查不到书时 把它替换为最相近的取值 筛选条件导致的无结果不纠错
+// q 和 search_content 分别统计 只纠正自身查不到书的一个 两者都查不到时不纠错
+// search_content 只在对应的字段中查找 没有可用的建议时返回 nil
+func (params *bookQuery) correct() (*service.Suggestion, error) {
+	textMiss, fieldMiss := false, false
+	if params.q != "" {
+		query, _, _, err := params.searchText(dao.Db.Model(&model.Book{}))
+		if err != nil {
+			return nil, err
+		}
+		if textMiss, err = isEmpty(query); err != nil {
+			return nil, err
+		}
+	}
+	if params.searchColumn != "" {
+		var err error
+		if fieldMiss, err = isEmpty(params.searchField(dao.Db.Model(&model.Book{}))); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case textMiss && !fieldMiss:
+		suggestion, err := service.DidYouMean(dao.Db, params.q)
+		if suggestion != nil {
+			params.q = suggestion.Text
+		}
+		return suggestion, err
+	case fieldMiss && !textMiss:
+		suggestion, err := service.DidYouMean(dao.Db, params.searchContent, params.searchColumn)
+		if suggestion != nil {
+			params.searchContent = suggestion.Text
+		}
+		return suggestion, err
+	}
+	return nil, nil
+}
+
+// isEmpty 查询是否没有任何结果
+func isEmpty(query *gorm.DB) (bool, error) {
+	var total int64
+	err := query.Count(&total).Error
+	return total == 0, err
+}
+
+// find 统计总数并查询一页书籍 返回高亮词项
+func (params *bookQuery) find(list *listing.List, books *[]BookHit) ([]string, *listing.Envelope, error) {
+	query, score, terms, err := params.scope(dao.Db.Model(&model.Book{}), "")
+	if err != nil {
+		return nil, nil, err
+	}
+	list.Query = query
+	orders := params.orders
+	if score != nil {
+		list.Select = func(db *gorm.DB) *gorm.DB {
+			return db.Select("t_books.*, ? AS score", *score)
+		}
+		if len(orders) == 0 {
+			orders = []listing.Order{{Column: "score", Desc: true, Expr: score}}
+		}
+	} else {
+		// 不检索时没有 score 列 只查询图书本身的列
+		list.Select = func(db *gorm.DB) *gorm.DB {
+			return db.Select("t_books.*")
+		}
+	}
+	list.Keyset = listing.NewKeyset(orders, listing.Order{Column: "id"})
+
+	columns := list.Keyset.Columns()
+	envelope, err := listing.Fetch(list, books, func(book *BookHit) []interface{} {
+		values := make([]interface{}, len(columns))
+		for i, column := range columns {
+			values[i] = bookSortValue(book, column)
+		}
+		return values
+	})
+	return terms, envelope, err
+}
+
+// bookSortValue 书籍在排序列上的取值 列名与 BookFields 一致
+func bookSortValue(book *BookHit, column string) interface{} {
+	switch column {
+	case "id":
+		return book.Id
+	case "name":
+		return book.Name
+	case "author":
+		return book.Author
+	case "publisher":
+		return book.Publisher
+	case "isbn":
+		return book.ISBN
+	case "category":
+		return book.Category
+	case "year":
+		return book.Year
+	case "price":
+		return book.Price
+	case "residue":
+		return book.Residue
+	case "created_at":
+		return book.CreatedAt
+	case "score":
+		return book.Score
+	}
+	return nil
+}
+
+// facets 按当前检索和筛选条件统计分面
+func (params *bookQuery) facets() (*service.BookFacets, error) {
+	return service.CountBookFacets(func(skip string) (*gorm.DB, error) {
+		query, _, _, err := params.scope(dao.Db.Model(&model.Book{}), skip)
+		return query, err
+	})
+}
+
+// HighlightBooks 为全文检索的结果填充各字段的命中片段
+func HighlightBooks(books []BookHit, terms []string) {
+	if len(terms) == 0 {
+		return
+	}
+	for i := range books {
+		highlights := map[string]string{}
+		for _, field := range service.BookSearchFields {
+			width := 0
+			if field.Name == "remark" {
+				width = remarkSnippetWidth
+			}
+			if snippet := search.Highlight(field.Value(&books[i].Book), terms, width); snippet != "" {
+				highlights[field.Name] = snippet
+			}
+		}
+		books[i].Highlights = highlights
+	}
+}
+
+// RespondListError 列表参数错误时返回400 字段不可用时列出可用取值 其他错误按业务错误处理
+func RespondListError(context *gin.Context, err error) {
+	var fieldErr *listing.FieldError
+	if errors.As(err, &fieldErr) {
+		context.JSON(http.StatusOK, gin.H{
+			"code":    http.StatusBadRequest,
+			"msg":     fieldErr.Error(),
+			"param":   fieldErr.Param,
+			"allowed": fieldErr.Allowed,
+		})
+		return
+	}
+	var valueErr *listing.ValueError
+	if errors.As(err, &valueErr) {
+		context.JSON(http.StatusOK, gin.H{
+			"code":  http.StatusBadRequest,
+			"msg":   valueErr.Error(),
+			"param": valueErr.Param,
+		})
+		return
+	}
+	RespondServiceError(context, err)
+}
@@ -2,9 +2,13 @@ package univer
 
 import (
 	"book-mgr-backend/dao"
+	"book-mgr-backend/middleware"
 	"book-mgr-backend/model"
+	"book-mgr-backend/password"
+	"book-mgr-backend/service"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"log"
 	"net/http"
 )
 
@@ -34,7 +38,8 @@ func HandleUserLogin(context *gin.Context) {
 		return
 	}
 
-	if user.Role != postData.Role {
+	// 管理端入口允许管理员和图书馆员 用户端入口要求角色一致
+	if !middleware.CanLoginAs(user.Role, postData.Role) {
 		context.JSON(http.StatusOK, gin.H{
 			"code":   http.StatusForbidden,
 			"authed": false,
@@ -43,7 +48,8 @@ func HandleUserLogin(context *gin.Context) {
 		return
 	}
 
-	if user.Password != postData.Password {
+	ok, needsUpgrade := password.Verify(user.Password, postData.Password)
+	if !ok {
 		context.JSON(http.StatusOK, gin.H{
 			"code":   http.StatusUnauthorized,
 			"authed": false,
@@ -52,12 +58,34 @@ func HandleUserLogin(context *gin.Context) {
 		return
 	}
 
+	// 历史遗留的明文密码在首次登录成功时转换为哈希
+	if needsUpgrade {
+		if hashed, err := password.Hash(postData.Password); err != nil {
+			log.Println("密码哈希失败 err: ", err)
+		} else if err := dao.Db.Model(&model.User{}).Where("id = ?", user.Id).Update("password", hashed).Error; err != nil {
+			log.Println("升级密码哈希失败 err: ", err)
+		}
+	}
+
+	// 签发访问令牌
+	token, expiresAt, err := middleware.IssueToken(user.Id, user.Role)
+	if err != nil {
+		context.JSON(http.StatusOK, gin.H{
+			"code":   http.StatusInternalServerError,
+			"authed": false,
+			"msg":    "签发令牌失败",
+		})
+		return
+	}
+
 	user.Password = ""
 	context.JSON(http.StatusOK, gin.H{
-		"code":   http.StatusOK,
-		"authed": true,
-		"user":   user,
-		"msg":    "验证通过",
+		"code":       http.StatusOK,
+		"authed":     true,
+		"user":       user,
+		"token":      token,
+		"expires_at": expiresAt.Unix(),
+		"msg":        "验证通过",
 	})
 }
 
@@ -75,10 +103,35 @@ func HandleUserRegister(context *gin.Context) {
 		})
 		return
 	}
+	if postData.Email == "" || postData.Password == "" {
+		context.JSON(http.StatusBadRequest, gin.H{
+			"code": http.StatusBadRequest,
+			"msg":  "请求数据无效",
+		})
+		return
+	}
+
+	if err := password.Validate(postData.Password); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{
+			"code": http.StatusBadRequest,
+			"msg":  err.Error(),
+		})
+		return
+	}
+
+	// 密码仅保存哈希值
+	hashed, err := password.Hash(postData.Password)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{
+			"code": http.StatusInternalServerError,
+			"msg":  "服务器错误，请稍后重试",
+		})
+		return
+	}
 	var newUser = model.User{
 		Email:    postData.Email,
-		Password: postData.Password, // 在真实应用中，建议先对密码进行哈希处理
-		Role:     "user",
+		Password: hashed,
+		Role:     model.RoleReader,
 	}
 	tx := dao.Db.Begin()
 	var existingUser model.User
@@ -111,11 +164,24 @@ func HandleUserRegister(context *gin.Context) {
 		return
 	}
 
+	// 借书证号按用户id生成
+	cardNo := service.CardNo(newUser.Id)
+	if err := tx.Model(&model.User{}).Where("id = ?", newUser.Id).Update("card_no", cardNo).Error; err != nil {
+		tx.Rollback()
+		context.JSON(http.StatusInternalServerError, gin.H{
+			"code":       http.StatusInternalServerError,
+			"registered": false,
+			"msg":        "注册失败",
+		})
+		return
+	}
+
 	tx.Commit()
 
 	context.JSON(http.StatusOK, gin.H{
 		"code":       http.StatusOK,
 		"registered": true,
 		"msg":        "注册成功",
+		"card_no":    cardNo,
 	})
 }
@@ -1 +1,105 @@
 package user
+
+import (
+	"book-mgr-backend/dao"
+	"book-mgr-backend/handler"
+	"book-mgr-backend/model"
+	"book-mgr-backend/service"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func HandleRenewBookById_User(context *gin.Context) {
+	postData := &struct {
+		BorrowId string `json:"borrow_id"`
+	}{}
+	if err := context.ShouldBind(postData); err != nil || postData.BorrowId == "" {
+		context.JSON(http.StatusOK, gin.H{
+			"code": http.StatusBadRequest,
+			"msg":  "请求参数错误",
+		})
+		return
+	}
+
+	// 只能续借自己的借阅记录
+	userId := handler.GetUserIdFromContext(context)
+	var history *model.History
+	if err := dao.Db.Transaction(func(tx *gorm.DB) (err error) {
+		history, err = service.RenewLoan(tx, userId, postData.BorrowId, time.Now())
+		return err
+	}); err != nil {
+		handler.RespondServiceError(context, err)
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{
+		"code":        http.StatusOK,
+		"msg":         "续借成功",
+		"due_at":      history.DueAt.Format("2006-01-02"),
+		"renew_count": history.RenewCount,
+	})
+}
+
+func HandlePlaceHold_User(context *gin.Context) {
+	postData := &struct {
+		BookId int64 `json:"book_id"`
+	}{}
+	if err := context.ShouldBind(postData); err != nil || postData.BookId <= 0 {
+		context.JSON(http.StatusOK, gin.H{
+			"code": http.StatusBadRequest,
+			"msg":  "请提供图书信息",
+		})
+		return
+	}
+
+	userId := handler.GetUserIdFromContext(context)
+	var hold *model.Hold
+	var position int64
+	err := dao.Db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if hold, err = service.PlaceHold(tx, userId, postData.BookId); err != nil {
+			return err
+		}
+		position, err = service.HoldPosition(tx, hold)
+		return err
+	})
+	if err != nil {
+		handler.RespondServiceError(context, err)
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{
+		"code":     http.StatusOK,
+		"msg":      "预约成功",
+		"hold_id":  hold.Id,
+		"position": position, // 当前排队位置
+	})
+}
+
+func HandleCancelHold_User(context *gin.Context) {
+	holdId, err := strconv.ParseInt(context.Query("id"), 10, 64)
+	if err != nil || holdId <= 0 {
+		context.JSON(http.StatusOK, gin.H{
+			"code": http.StatusBadRequest,
+			"msg":  "请求参数错误",
+		})
+		return
+	}
+
+	// 只能取消自己的预约
+	userId := handler.GetUserIdFromContext(context)
+	if err := dao.Db.Transaction(func(tx *gorm.DB) error {
+		return service.CancelHold(tx, holdId, userId, time.Now())
+	}); err != nil {
+		handler.RespondServiceError(context, err)
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{
+		"code": http.StatusOK,
+		"msg":  "已取消预约",
+	})
+}
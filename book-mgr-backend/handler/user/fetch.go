@@ -3,26 +3,21 @@ package user
 import (
 	"book-mgr-backend/dao"
 	"book-mgr-backend/handler"
+	"book-mgr-backend/listing"
 	"book-mgr-backend/model"
+	"book-mgr-backend/service"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 	"log"
 	"net/http"
-	"strconv"
 	"time"
 )
 
 func HandleGetSummary_User(context *gin.Context) {
-	id, err := strconv.ParseInt(context.Query("user_id"), 10, 64)
-	if err != nil {
-		context.JSON(http.StatusOK, gin.H{
-			"code": http.StatusInternalServerError,
-			"msg":  err.Error(),
-		})
-		return
-	}
-	log.Println(id)
+	// 用户id从令牌中获取
+	id := handler.GetUserIdFromContext(context)
 	if id <= 0 {
 		context.JSON(http.StatusOK, gin.H{
 			"code": http.StatusBadRequest,
@@ -81,90 +76,55 @@ func HandleGetSummary_User(context *gin.Context) {
 	})
 }
 
+// HandleSuggestBooks_User 书名 作者和出版社的输入联想
+func HandleSuggestBooks_User(context *gin.Context) {
+	handler.RespondBookSuggestions(context)
+}
+
 func HandleGetAllBooks_User(context *gin.Context) {
 	// 获取分页参数
-	// 从查询参数中获取页码和页面大小，并检查是否有错误
-	err, page, size := handler.GetPage2SizeFormQueryParams(context)
+	// 从查询参数中获取页码和页面大小 页面大小有上限 提供 cursor 时按游标翻页
+	list, err := handler.NewList(context, listing.DefaultPageSize)
 	if err != nil {
-		// 如果缺少分页参数，则返回错误信息
-		context.JSON(http.StatusOK, gin.H{
-			"code": http.StatusInternalServerError,
-			"msg":  "缺少查询参数",
-		})
-		return
-	}
-	log.Println("Page:", page, "Size:", size)
-
-	// 获取搜索和排序参数
-	// search_by: 要搜索的字段（如 name, author, publisher），对应数据库中的列名
-	searchBy := context.Query("search_by")
-	// search_content: 搜索内容，即实际的搜索值
-	searchContent := context.Query("search_content")
-	// search_sort: 排序方式，如 "ASC" 或 "DESC"
-	searchSort := context.Query("search_sort")
-
-	// 获取总记录数
-	// 查询书籍的总记录数，以便用于计算分页
-	var totalBooks int64
-	if result := dao.Db.Model(&model.Book{}).Count(&totalBooks); result.Error != nil {
-		// 如果查询总记录数出错，则返回错误信息
-		context.JSON(http.StatusOK, gin.H{
-			"code": http.StatusInternalServerError,
-			"msg":  "查询总记录数出错",
-		})
+		handler.RespondListError(context, err)
 		return
 	}
-
-	// 计算总页数
-	// 根据总记录数和页面大小计算总页数，用于返回给客户端
-	pageCount := (totalBooks + int64(size) - 1) / int64(size)
+	log.Println("Page:", list.Page, "Size:", list.Size)
 
 	// 查询分页数据
-	// 根据分页参数计算偏移量，并查询数据库中的书籍信息
-	var books []model.Book
-	offset := (page - 1) * size
-	query := dao.Db.Model(&model.Book{}).Offset(int(offset)).Limit(int(size))
-
-	// 如果指定了搜索条件，则添加过滤条件
-	if searchBy != "" && searchContent != "" {
-		query = query.Where(searchBy+" LIKE ?", "%"+searchContent+"%")
-	}
-
-	// 如果指定了排序方式，则添加排序条件
-	if searchSort != "" {
-		query = query.Order("`" + searchBy + "` " + searchSort)
-	}
-
-	// 执行查询
-	if result := query.Find(&books); result.Error != nil {
-		// 如果查询出错，则返回错误信息
-		context.JSON(http.StatusOK, gin.H{
-			"code": http.StatusInternalServerError,
-			"msg":  "查询出错",
-		})
+	// 添加搜索 筛选和排序条件 总数与分页使用相同的条件 字段只能取白名单中的值
+	result, err := handler.FindBooks(context, list)
+	if err != nil {
+		handler.RespondListError(context, err)
 		return
 	}
 
-	// 返回分页数据和总页数
-	// 返回书籍列表、总页数和总记录数给客户端
-	context.JSON(http.StatusOK, gin.H{
-		"code":        http.StatusOK,
-		"books":       books,
-		"page_count":  pageCount,
-		"total_books": totalBooks,
-	})
+	// 返回书籍列表和分页信息
+	context.JSON(http.StatusOK, handler.ListBody(result.Envelope, gin.H{
+		"code":         http.StatusOK,
+		"books":        result.Books,
+		"total_books":  result.Envelope.Total,
+		"did_you_mean": result.DidYouMean, // 原查询没有结果时实际使用的纠错建议
+		"facets":       result.Facets,
+	}))
 }
 
 type BorrowHistoryResponse struct {
-	Id        int64  `json:"id"`
-	UserId    int64  `json:"user_id"`
-	BookId    int64  `json:"book_id"`
-	BorrowId  string `json:"borrow_id"`
-	CreatedAt string `json:"created_at"`
-	IsBack    bool   `json:"is_back"`
-	Keep      string `json:"keep"` // 留存时间
-	Name      string `json:"name"`
-	ISBN      string `json:"isbn"`
+	Id          int64  `json:"id"`
+	UserId      int64  `json:"user_id"`
+	BookId      int64  `json:"book_id"`
+	BorrowId    string `json:"borrow_id"`
+	CreatedAt   string `json:"created_at"`
+	DueAt       string `json:"due_at"` // 应还日期
+	IsBack      bool   `json:"is_back"`
+	ReturnedAt  string `json:"returned_at"`  // 归还时间
+	Outcome     string `json:"outcome"`      // 结束方式 returned lost damaged
+	Overdue     bool   `json:"overdue"`      // 是否超期
+	DaysOverdue int64  `json:"days_overdue"` // 超期天数
+	RenewCount  int    `json:"renew_count"`  // 续借次数
+	Keep        string `json:"keep"`         // 留存时间
+	Name        string `json:"name"`
+	ISBN        string `json:"isbn"`
 }
 
 func HandleGetAllMyBorrowed_User(c *gin.Context) {
@@ -172,10 +132,13 @@ func HandleGetAllMyBorrowed_User(c *gin.Context) {
 	db := dao.Db
 
 	// 获取分页和查询参数
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	size, _ := strconv.Atoi(c.DefaultQuery("size", "10"))
+	list, err := handler.NewList(c, listing.DefaultPageSize)
+	if err != nil {
+		handler.RespondListError(c, err)
+		return
+	}
 	name := c.DefaultQuery("name", "")
-	userId, _ := strconv.Atoi(c.DefaultQuery("user_id", "0")) // 获取 user_id
+	userId := handler.GetUserIdFromContext(c) // 从令牌中获取 user_id
 
 	// 如果 user_id 为 0，返回错误
 	if userId == 0 {
@@ -183,157 +146,242 @@ func HandleGetAllMyBorrowed_User(c *gin.Context) {
 		return
 	}
 
-	// 计算偏移量
-	offset := (page - 1) * size
-
-	// 查询总记录数（不需要 Offset 和 Limit）
-	var totalCount int64
-	countQuery := db.Model(&model.History{}).Where("user_id = ?", userId)
-	if name != "" {
-		countQuery = countQuery.Joins("JOIN t_books ON t_books.id = t_history.book_id").
-			Where("t_books.name LIKE ?", "%"+name+"%")
-	}
-	countQuery.Count(&totalCount)
-
-	// 查询分页记录并预加载关联的书籍信息
+	// 总数与分页共用同一组筛选条件
 	var histories []model.History
-	query := db.Preload("Book").Where("user_id = ?", userId)
+	query := db.Model(&model.History{}).Where("t_history.user_id = ?", userId)
 	if name != "" {
 		query = query.Joins("JOIN t_books ON t_books.id = t_history.book_id").
 			Where("t_books.name LIKE ?", "%"+name+"%")
 	}
-	if err := query.Offset(offset).Limit(size).Order("t_history.created_at DESC").Find(&histories).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+	list.Query = query
+	// 分页记录预加载关联的书籍信息
+	list.Select = func(db *gorm.DB) *gorm.DB {
+		return db.Preload("Book")
+	}
+	// 借阅时间相同时按id排序
+	list.Keyset = listing.NewKeyset(
+		[]listing.Order{{Column: "t_history.created_at", Desc: true}},
+		listing.Order{Column: "t_history.id", Desc: true},
+	)
+	envelope, err := listing.Fetch(list, &histories, func(history *model.History) []interface{} {
+		return []interface{}{history.CreatedAt, history.Id}
+	})
+	if err != nil {
+		handler.RespondListError(c, err)
 		return
 	}
 
 	// 构造响应
+	now := time.Now()
 	var response []BorrowHistoryResponse
 	for _, history := range histories {
 		book := history.Book // 直接获取预加载的 Book 信息
 
-		// 计算留存时间
-		keepDuration := time.Since(*history.BorrowedAt)
-		keep := keepDuration.String()
+		// 计算留存时间 已归还的算到归还时
+		keepUntil, returnedAt := now, ""
+		if history.ReturnedAt != nil {
+			keepUntil = *history.ReturnedAt
+			returnedAt = history.ReturnedAt.Format("2006-01-02")
+		}
+		keepDuration := keepUntil.Sub(*history.BorrowedAt)
+		keep := fmt.Sprintf("%d天%d小时", int64(keepDuration.Hours())/24, int64(keepDuration.Hours())%24)
+
+		dueAt := ""
+		if history.DueAt != nil {
+			dueAt = history.DueAt.Format("2006-01-02")
+		}
 
 		// 构建响应数据
 		response = append(response, BorrowHistoryResponse{
-			Id:        history.Id,
-			UserId:    history.UserId,
-			BookId:    history.BookId,
-			BorrowId:  history.BorrowId,
-			CreatedAt: history.BorrowedAt.Format("2006-01-02"),
-			IsBack:    history.IsBack,
-			Keep:      keep,
-			Name:      book.Name,
-			ISBN:      book.ISBN,
+			Id:          history.Id,
+			UserId:      history.UserId,
+			BookId:      history.BookId,
+			BorrowId:    history.BorrowId,
+			CreatedAt:   history.BorrowedAt.Format("2006-01-02"),
+			DueAt:       dueAt,
+			IsBack:      history.IsBack,
+			ReturnedAt:  returnedAt,
+			Outcome:     history.Outcome,
+			Overdue:     history.IsOverdue(now),
+			DaysOverdue: history.DaysOverdue(now),
+			RenewCount:  history.RenewCount,
+			Keep:        keep,
+			Name:        book.Name,
+			ISBN:        book.ISBN,
 		})
 	}
 
-	// 计算总页数
-	pageCount := (totalCount + int64(size) - 1) / int64(size)
-
 	// 返回结果
-	c.JSON(http.StatusOK, gin.H{
-		"code":       200,
-		"histories":  response,
-		"page_count": pageCount,
-	})
+	c.JSON(http.StatusOK, handler.ListBody(envelope, gin.H{
+		"code":      200,
+		"histories": response,
+	}))
 }
 
-func HandleBorrowBookById_User(context *gin.Context) {
-	postData := &struct {
-		UserId int64 `json:"user_id"`
-		BookId int64 `json:"book_id"`
-	}{}
-	if err := context.ShouldBind(postData); err != nil {
+type HoldResponse struct {
+	Id        int64  `json:"id"`
+	BookId    int64  `json:"book_id"`
+	Name      string `json:"name"`
+	ISBN      string `json:"isbn"`
+	Status    string `json:"status"`
+	Position  int64  `json:"position"`   // 排队位置 仅排队中的预约有效
+	ExpiresAt string `json:"expires_at"` // 取书截止时间 仅待取书的预约有效
+	CreatedAt string `json:"created_at"`
+}
+
+func HandleGetMyHolds_User(context *gin.Context) {
+	userId := handler.GetUserIdFromContext(context)
+	// 默认只返回排队中和待取书的预约
+	all := context.Query("all") == "true"
+
+	query := dao.Db.Preload("Book").Where("user_id = ?", userId)
+	if !all {
+		query = query.Where("status IN ?", []string{model.HoldWaiting, model.HoldReady})
+	}
+	var holds []model.Hold
+	if err := query.Order("id DESC").Find(&holds).Error; err != nil {
 		context.JSON(http.StatusOK, gin.H{
-			"code": http.StatusBadRequest,
-			"msg":  "请提供用户和图书信息",
+			"code": http.StatusInternalServerError,
+			"msg":  "查询预约失败",
 		})
 		return
 	}
-	//log.Println(postData)
 
-	if postData.UserId <= 0 || postData.BookId <= 0 {
-		context.JSON(http.StatusOK, gin.H{
-			"code": http.StatusBadRequest,
-			"msg":  "请求参数不正确",
+	response := make([]HoldResponse, 0, len(holds))
+	for _, hold := range holds {
+		position, err := service.HoldPosition(dao.Db, &hold)
+		if err != nil {
+			context.JSON(http.StatusOK, gin.H{
+				"code": http.StatusInternalServerError,
+				"msg":  "查询排队位置失败",
+			})
+			return
+		}
+		expiresAt := ""
+		if hold.Status == model.HoldReady && hold.ExpiresAt != nil {
+			expiresAt = hold.ExpiresAt.Format("2006-01-02 15:04:05")
+		}
+		response = append(response, HoldResponse{
+			Id:        hold.Id,
+			BookId:    hold.BookId,
+			Name:      hold.Book.Name,
+			ISBN:      hold.Book.ISBN,
+			Status:    hold.Status,
+			Position:  position,
+			ExpiresAt: expiresAt,
+			CreatedAt: hold.CreatedAt.Format("2006-01-02 15:04:05"),
 		})
 	}
-	// 开启事务
-	tx := dao.Db.Begin()
-
-	// 检查图书库存
-	var book model.Book
-	if err := tx.First(&book, postData.BookId).Error; err != nil {
-		tx.Rollback()
-		context.JSON(http.StatusInternalServerError, gin.H{
-			"code": http.StatusInternalServerError,
-			"msg":  "无法查询图书",
-		})
+
+	context.JSON(http.StatusOK, gin.H{
+		"code":  http.StatusOK,
+		"holds": response,
+		"msg":   "success",
+	})
+}
+
+func HandleGetMyFines_User(context *gin.Context) {
+	list, err := handler.NewList(context, listing.DefaultPageSize)
+	if err != nil {
+		handler.RespondListError(context, err)
 		return
 	}
-	if book.Residue <= 0 {
-		tx.Rollback()
+	userId := handler.GetUserIdFromContext(context)
+
+	balance, err := service.Balance(dao.Db, userId)
+	if err != nil {
 		context.JSON(http.StatusOK, gin.H{
-			"code": http.StatusUnprocessableEntity,
-			"msg":  "剩余数量不足",
+			"code": http.StatusInternalServerError,
+			"msg":  "查询欠款失败",
 		})
 		return
 	}
-
-	// 将图书库存减1
-	if err := tx.Model(&model.Book{}).Where("id = ?", postData.BookId).Update("residue", book.Residue-1).Error; err != nil {
-		tx.Rollback()
-		context.JSON(http.StatusInternalServerError, gin.H{
+	// 尚未归还的超期借阅 归还时才会记账
+	accruing, err := service.AccruingFines(dao.Db, userId, time.Now())
+	if err != nil {
+		context.JSON(http.StatusOK, gin.H{
 			"code": http.StatusInternalServerError,
-			"msg":  "更新图书库存失败",
+			"msg":  "查询应计罚款失败",
 		})
 		return
 	}
 
-	// 创建借阅订单号
-	borrowId := createBorrowId(postData.UserId, postData.BookId)
-
-	// 增加借阅记录
-	nowTime := time.Now()
-	history := model.History{
-		BorrowId:   borrowId,
-		UserId:     postData.UserId,
-		BookId:     postData.BookId,
-		BorrowedAt: &nowTime,
-		IsBack:     false, // 未归还
+	var entries []model.FineEntry
+	list.Query = dao.Db.Model(&model.FineEntry{}).Where("user_id = ?", userId)
+	list.Keyset = listing.NewKeyset(nil, listing.Order{Column: "id", Desc: true})
+	envelope, err := listing.Fetch(list, &entries, func(entry *model.FineEntry) []interface{} {
+		return []interface{}{entry.Id}
+	})
+	if err != nil {
+		handler.RespondListError(context, err)
+		return
 	}
-	if err := tx.Create(&history).Error; err != nil {
-		tx.Rollback()
-		context.JSON(http.StatusInternalServerError, gin.H{
-			"code": http.StatusInternalServerError,
-			"msg":  "创建借阅记录失败",
+
+	context.JSON(http.StatusOK, handler.ListBody(envelope, gin.H{
+		"code":     http.StatusOK,
+		"balance":  balance,  // 当前欠款(分)
+		"accruing": accruing, // 未归还超期借阅的应计罚款(分)
+		"entries":  entries,
+		"msg":      "success",
+	}))
+}
+
+func HandleBorrowBookById_User(context *gin.Context) {
+	postData := &struct {
+		BookId int64 `json:"book_id"`
+	}{}
+	if err := context.ShouldBind(postData); err != nil {
+		context.JSON(http.StatusOK, gin.H{
+			"code": http.StatusBadRequest,
+			"msg":  "请提供图书信息",
 		})
 		return
 	}
+	//log.Println(postData)
 
-	// 提交事务
-	if err := tx.Commit().Error; err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{
-			"code": http.StatusInternalServerError,
-			"msg":  "提交事务失败",
+	// 借阅人以令牌中的身份为准
+	userId := handler.GetUserIdFromContext(context)
+	if userId <= 0 || postData.BookId <= 0 {
+		context.JSON(http.StatusOK, gin.H{
+			"code": http.StatusBadRequest,
+			"msg":  "请求参数不正确",
+		})
+		return
+	}
+	// 借阅人的角色决定借阅上限
+	patron := &model.User{Id: userId, Role: handler.GetRoleFromContext(context)}
+	var history *model.History
+	var item *model.Copy
+	err := dao.Db.Transaction(func(tx *gorm.DB) (err error) {
+		history, item, err = service.Checkout(tx, patron, postData.BookId, "", 0, time.Now())
+		return err
+	})
+	if errors.Is(err, service.ErrNoCopies) {
+		context.JSON(http.StatusOK, gin.H{
+			"code":     http.StatusUnprocessableEntity,
+			"msg":      service.ErrNoCopies.Msg,
+			"reason":   service.ErrNoCopies.Reason,
+			"can_hold": true, // 可以预约排队
 		})
 		return
 	}
+	if err != nil {
+		handler.RespondServiceError(context, err)
+		return
+	}
 
 	// 成功响应
 	context.JSON(http.StatusOK, gin.H{
-		"code": http.StatusOK,
-		"msg":  "成功",
+		"code":      http.StatusOK,
+		"msg":       "成功",
+		"borrow_id": history.BorrowId,
+		"barcode":   item.Barcode,
 	})
 }
 
 func HandleReturnBookById_User(context *gin.Context) {
 	postData := &struct {
 		BorrowId string `json:"borrow_id"`
-		UserId   int64  `json:"user_id"`
 		BookId   int64  `json:"book_id"`
 	}{}
 
@@ -345,7 +393,9 @@ func HandleReturnBookById_User(context *gin.Context) {
 		return
 	}
 
-	if postData.UserId <= 0 || postData.BookId <= 0 || postData.BorrowId == "" {
+	// 只能归还自己的借阅记录
+	userId := handler.GetUserIdFromContext(context)
+	if userId <= 0 || postData.BookId <= 0 || postData.BorrowId == "" {
 		context.JSON(http.StatusOK, gin.H{
 			"code": http.StatusBadRequest,
 			"msg":  "请求参数错误",
@@ -353,49 +403,37 @@ func HandleReturnBookById_User(context *gin.Context) {
 		return
 	}
 
-	tx := dao.Db.Begin()
-
-	// 更新 History 表，将 is_back 设置为 true
-	if err := tx.Model(&model.History{}).
-		Where("borrow_id = ? AND user_id = ? AND book_id = ?", postData.BorrowId, postData.UserId, postData.BookId).
-		Update("is_back", true).Error; err != nil {
-		tx.Rollback()
+	// 只查找本人的借阅记录 他人的借阅同样视为不存在
+	var history model.History
+	if err := dao.Db.Where("borrow_id = ? AND user_id = ? AND book_id = ?", postData.BorrowId, userId, postData.BookId).
+		First(&history).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			handler.RespondServiceError(context, service.ErrLoanNotFound)
+			return
+		}
 		context.JSON(http.StatusOK, gin.H{
 			"code": http.StatusInternalServerError,
-			"msg":  "更新借阅记录失败",
+			"msg":  "查询借阅记录失败",
 		})
 		return
 	}
 
-	// 更新 Book 表，将 residue +1
-	if err := tx.Model(&model.Book{}).
-		Where("id = ?", postData.BookId).
-		Update("residue", gorm.Expr("residue + ?", 1)).Error; err != nil {
-		tx.Rollback()
-		context.JSON(http.StatusOK, gin.H{
-			"code": http.StatusInternalServerError,
-			"msg":  "更新书籍库存失败",
-		})
+	var fine *model.FineEntry
+	if err := dao.Db.Transaction(func(tx *gorm.DB) (err error) {
+		fine, err = service.ReturnLoan(tx, &history, 0, time.Now())
+		return err
+	}); err != nil {
+		handler.RespondServiceError(context, err)
 		return
 	}
 
-	// 提交事务
-	if err := tx.Commit().Error; err != nil {
-		context.JSON(http.StatusOK, gin.H{
-			"code": http.StatusInternalServerError,
-			"msg":  "事务提交失败",
-		})
-		return
+	var fineAmount int64
+	if fine != nil {
+		fineAmount = fine.Amount
 	}
-
 	context.JSON(http.StatusOK, gin.H{
 		"code": http.StatusOK,
 		"msg":  "归还成功",
+		"fine": fineAmount, // 本次产生的超期罚款(分)
 	})
 }
-
-// 创建订单号函数，格式为 <年><月><日><用户id><图书id><当天时间戳>
-func createBorrowId(userId, bookId int64) string {
-	timestamp := time.Now().Format("20060102") // 格式化日期
-	return fmt.Sprintf("%s%d%d%d", timestamp, userId, bookId, time.Now().Unix()%86400)
-}
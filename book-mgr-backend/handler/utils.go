@@ -1,12 +1,71 @@
 package handler
 
 import (
+	"book-mgr-backend/listing"
+	"book-mgr-backend/service"
 	"github.com/gin-gonic/gin"
+	"net/http"
 	"strconv"
 )
 
-func GetPage2SizeFormQueryParams(context *gin.Context) (err error, page int64, size int64) {
-	page, err = strconv.ParseInt(context.DefaultQuery("page", "1"), 10, 64)
-	size, err = strconv.ParseInt(context.DefaultQuery("size", "10"), 10, 64)
-	return
+// 鉴权中间件写入上下文的键
+const (
+	CtxUserIdKey = "user_id"
+	CtxRoleKey   = "role"
+)
+
+// NewList 按分页参数创建列表查询 页码从1开始 size 不能超过 listing.MaxPageSize
+// cursor 为上一页返回的 next_cursor 提供时按游标翻页并忽略页码
+func NewList(context *gin.Context, defaultSize int) (*listing.List, error) {
+	page, err := strconv.Atoi(context.DefaultQuery("page", "1"))
+	if err != nil {
+		return nil, &listing.ValueError{Param: "page", Value: context.Query("page"), Expect: "整数"}
+	}
+	size, err := strconv.Atoi(context.DefaultQuery("size", strconv.Itoa(defaultSize)))
+	if err != nil {
+		return nil, &listing.ValueError{Param: "size", Value: context.Query("size"), Expect: "整数"}
+	}
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 {
+		size = defaultSize
+	}
+	if size > listing.MaxPageSize {
+		size = listing.MaxPageSize
+	}
+	return &listing.List{Page: page, Size: size, Cursor: context.Query("cursor")}, nil
+}
+
+// ListBody 在响应中加入统一的分页信息 total page size page_count next_cursor
+func ListBody(envelope *listing.Envelope, body gin.H) gin.H {
+	body["total"] = envelope.Total
+	body["page"] = envelope.Page
+	body["size"] = envelope.Size
+	body["page_count"] = envelope.PageCount
+	body["next_cursor"] = envelope.NextCursor
+	return body
+}
+
+// GetUserIdFromContext 获取令牌中的用户id 未经过鉴权时返回0
+func GetUserIdFromContext(context *gin.Context) int64 {
+	return context.GetInt64(CtxUserIdKey)
+}
+
+// GetRoleFromContext 获取令牌中的用户角色
+func GetRoleFromContext(context *gin.Context) string {
+	return context.GetString(CtxRoleKey)
+}
+
+// RespondServiceError 将业务错误写入响应 带有原因码时一并返回
+func RespondServiceError(context *gin.Context, err error) {
+	code, msg, reason := service.Describe(err)
+	body := gin.H{
+		"code": code,
+		"msg":  msg,
+	}
+	if reason != "" {
+		body["reason"] = reason
+	}
+	context.JSON(http.StatusOK, body)
 }
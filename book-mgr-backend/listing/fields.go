@@ -0,0 +1,163 @@
+package listing
+
+import (
+	"fmt"
+	"gorm.io/gorm/clause"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Field 对客户端开放的字段 名称与数据库列分开 列名只来自白名单
+type Field struct {
+	Column     string
+	Searchable bool // 允许作为 search_by
+	Sortable   bool // 允许参与排序
+}
+
+// Fields 列表接口开放的字段 以客户端使用的名称为键
+type Fields map[string]Field
+
+// Order 一个排序条件 Expr 非空时按表达式比较 Column 为该表达式在查询结果中的别名
+type Order struct {
+	Column string
+	Desc   bool
+	Expr   *clause.Expr
+}
+
+// FieldError 客户端传入了未开放的字段或无法识别的排序方向
+type FieldError struct {
+	Param   string   // 出错的查询参数
+	Value   string   // 客户端传入的值
+	Allowed []string // 该参数可用的取值
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("参数 %s 不支持 %q 可用取值: %s", e.Param, e.Value, strings.Join(e.Allowed, ", "))
+}
+
+var directions = []string{"asc", "desc"}
+
+// Searchable 可搜索的字段名 按字母排序
+func (f Fields) Searchable() []string {
+	return f.names(func(field Field) bool { return field.Searchable })
+}
+
+// Sortable 可排序的字段名 按字母排序
+func (f Fields) Sortable() []string {
+	return f.names(func(field Field) bool { return field.Sortable })
+}
+
+func (f Fields) names(keep func(Field) bool) []string {
+	names := make([]string, 0, len(f))
+	for name, field := range f {
+		if keep(field) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SearchColumn 将 search_by 的取值换成数据库列
+func (f Fields) SearchColumn(param, name string) (string, error) {
+	field, ok := f[strings.ToLower(strings.TrimSpace(name))]
+	if !ok || !field.Searchable {
+		return "", &FieldError{Param: param, Value: name, Allowed: f.Searchable()}
+	}
+	return field.Column, nil
+}
+
+// ParseSort 解析多字段排序 形如 "year:desc,name" 或 "-year,name"
+// 未写方向时为升序 同一字段只取第一次出现
+func (f Fields) ParseSort(param, raw string) ([]Order, error) {
+	var orders []Order
+	seen := map[string]bool{}
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, direction, hasDirection := strings.Cut(part, ":")
+		desc := false
+		if strings.HasPrefix(name, "-") {
+			name, desc = name[1:], true
+		}
+		if hasDirection {
+			var err error
+			if desc, err = ParseDirection(param, direction); err != nil {
+				return nil, err
+			}
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		field, ok := f[name]
+		if !ok || !field.Sortable {
+			return nil, &FieldError{Param: param, Value: name, Allowed: f.Sortable()}
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		orders = append(orders, Order{Column: field.Column, Desc: desc})
+	}
+	return orders, nil
+}
+
+// ParseDirection 解析排序方向 只接受 asc 和 desc 不区分大小写
+func ParseDirection(param, raw string) (desc bool, err error) {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "asc":
+		return false, nil
+	case "desc":
+		return true, nil
+	}
+	return false, &FieldError{Param: param, Value: raw, Allowed: directions}
+}
+
+// ValueError 查询参数的值格式不正确
+type ValueError struct {
+	Param  string // 出错的查询参数
+	Value  string // 客户端传入的值
+	Expect string // 期望的格式
+}
+
+func (e *ValueError) Error() string {
+	return fmt.Sprintf("参数 %s 的值 %q 无效 需为%s", e.Param, e.Value, e.Expect)
+}
+
+// ParseInt 解析可选的整数参数 为空时返回 nil
+func ParseInt(param, raw string) (*int64, error) {
+	if raw = strings.TrimSpace(raw); raw == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return nil, &ValueError{Param: param, Value: raw, Expect: "整数"}
+	}
+	return &value, nil
+}
+
+// ParseFloat 解析可选的数值参数 为空时返回 nil
+func ParseFloat(param, raw string) (*float64, error) {
+	if raw = strings.TrimSpace(raw); raw == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, &ValueError{Param: param, Value: raw, Expect: "数字"}
+	}
+	return &value, nil
+}
+
+// ParseBool 解析可选的布尔参数 为空时返回 nil
+func ParseBool(param, raw string) (*bool, error) {
+	if raw = strings.TrimSpace(raw); raw == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return nil, &ValueError{Param: param, Value: raw, Expect: "true 或 false"}
+	}
+	return &value, nil
+}
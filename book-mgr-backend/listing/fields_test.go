@@ -0,0 +1,83 @@
+package listing
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var testFields = Fields{
+	"id":     {Column: "id", Sortable: true},
+	"name":   {Column: "name", Searchable: true, Sortable: true},
+	"remark": {Column: "remark", Searchable: true},
+	"year":   {Column: "pub_year", Sortable: true},
+}
+
+func TestParseSort(t *testing.T) {
+	cases := []struct {
+		raw  string
+		want []Order
+	}{
+		{"", nil},
+		{"name", []Order{{Column: "name"}}},
+		{"year:desc, Name", []Order{{Column: "pub_year", Desc: true}, {Column: "name"}}},
+		{"-year,name:ASC", []Order{{Column: "pub_year", Desc: true}, {Column: "name"}}},
+		{"name,name:desc", []Order{{Column: "name"}}},
+		{",,id,", []Order{{Column: "id"}}},
+	}
+	for _, c := range cases {
+		got, err := testFields.ParseSort("sort", c.raw)
+		if err != nil || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ParseSort(%q) = %+v, %v 期望 %+v", c.raw, got, err, c.want)
+		}
+	}
+}
+
+func TestParseSortRejects(t *testing.T) {
+	cases := map[string][]string{
+		"remark":    {"id", "name", "year"}, // 只能搜索不能排序
+		"password":  {"id", "name", "year"},
+		"name:up":   {"asc", "desc"},
+		"year;drop": {"id", "name", "year"},
+	}
+	for raw, allowed := range cases {
+		_, err := testFields.ParseSort("sort", raw)
+		var fieldErr *FieldError
+		if !errors.As(err, &fieldErr) || fieldErr.Param != "sort" || !reflect.DeepEqual(fieldErr.Allowed, allowed) {
+			t.Errorf("ParseSort(%q) err=%v 期望可用取值 %v", raw, err, allowed)
+		}
+	}
+}
+
+func TestSearchColumn(t *testing.T) {
+	if column, err := testFields.SearchColumn("search_by", " Name "); err != nil || column != "name" {
+		t.Errorf("SearchColumn(Name) = %q, %v", column, err)
+	}
+	_, err := testFields.SearchColumn("search_by", "year")
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) || !reflect.DeepEqual(fieldErr.Allowed, []string{"name", "remark"}) {
+		t.Errorf("SearchColumn(year) err=%v", err)
+	}
+}
+
+func TestParseValues(t *testing.T) {
+	if v, err := ParseInt("year_min", " 1998 "); err != nil || *v != 1998 {
+		t.Errorf("ParseInt = %v, %v", v, err)
+	}
+	if v, err := ParseInt("year_min", ""); err != nil || v != nil {
+		t.Errorf("空值应返回 nil: %v, %v", v, err)
+	}
+	for _, raw := range []string{"NaN", "Inf", "-inf", "abc"} {
+		if _, err := ParseFloat("price_min", raw); err == nil {
+			t.Errorf("ParseFloat(%q) 应返回错误", raw)
+		}
+	}
+	if v, err := ParseBool("available", "true"); err != nil || !*v {
+		t.Errorf("ParseBool = %v, %v", v, err)
+	}
+	_, err := ParseBool("available", "yes")
+	var valueErr *ValueError
+	if !errors.As(err, &valueErr) || valueErr.Param != "available" {
+		t.Errorf("ParseBool(yes) err=%v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package listing
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+	"time"
+)
+
+// 分页大小 超过上限时按上限处理
+const (
+	DefaultPageSize = 10
+	MaxPageSize     = 100
+)
+
+// Keyset 按排序键翻页 排序末尾总有唯一列兜底 保证顺序稳定
+// 游标记录上一页最后一行的排序键 下一页从其后开始 不受中途插入的行影响
+type Keyset struct {
+	Orders []Order
+}
+
+// NewKeyset 在排序条件末尾补上兜底列
+func NewKeyset(orders []Order, tiebreak Order) *Keyset {
+	for _, order := range orders {
+		if order.Column == tiebreak.Column {
+			return &Keyset{Orders: orders}
+		}
+	}
+	return &Keyset{Orders: append(append([]Order{}, orders...), tiebreak)}
+}
+
+// Columns 排序列的名称 与游标中的取值一一对应
+func (k *Keyset) Columns() []string {
+	columns := make([]string, len(k.Orders))
+	for i, order := range k.Orders {
+		columns[i] = order.Column
+	}
+	return columns
+}
+
+// OrderBy 添加排序条件
+func (k *Keyset) OrderBy(db *gorm.DB) *gorm.DB {
+	for _, order := range k.Orders {
+		db = db.Order(clause.OrderByColumn{Column: clause.Column{Name: order.Column}, Desc: order.Desc})
+	}
+	return db
+}
+
+// After 只查询排在游标之后的行 cursor 为空时不添加条件
+func (k *Keyset) After(db *gorm.DB, cursor string) (*gorm.DB, error) {
+	if cursor == "" {
+		return db, nil
+	}
+	values, err := k.decode(cursor)
+	if err != nil {
+		return nil, err
+	}
+	// (a > ?) OR (a = ? AND b > ?) OR ... 降序时比较方向相反
+	var disjuncts []string
+	var vars []interface{}
+	for i, order := range k.Orders {
+		var conjuncts []string
+		for j := 0; j < i; j++ {
+			conjuncts = append(conjuncts, "? = ?")
+			vars = append(vars, k.operand(j), values[j])
+		}
+		comparison := "? > ?"
+		if order.Desc {
+			comparison = "? < ?"
+		}
+		conjuncts = append(conjuncts, comparison)
+		vars = append(vars, k.operand(i), values[i])
+		disjuncts = append(disjuncts, "("+strings.Join(conjuncts, " AND ")+")")
+	}
+	return db.Where(clause.Expr{SQL: "(" + strings.Join(disjuncts, " OR ") + ")", Vars: vars}), nil
+}
+
+func (k *Keyset) operand(i int) interface{} {
+	if k.Orders[i].Expr != nil {
+		return *k.Orders[i].Expr
+	}
+	return clause.Column{Name: k.Orders[i].Column}
+}
+
+// cursorPayload 游标内容 Key 为排序键 换了排序方式的游标不能继续使用
+type cursorPayload struct {
+	Key    string        `json:"k"`
+	Values []cursorValue `json:"v"`
+}
+
+// cursorValue 保留取值的类型 时间按原类型比较 不能退化成字符串
+type cursorValue struct {
+	Str   *string    `json:"s,omitempty"`
+	Int   *int64     `json:"i,omitempty"`
+	Float *float64   `json:"f,omitempty"`
+	Time  *time.Time `json:"t,omitempty"`
+	Bool  *bool      `json:"b,omitempty"`
+}
+
+func (k *Keyset) key() string {
+	parts := make([]string, len(k.Orders))
+	for i, order := range k.Orders {
+		parts[i] = order.Column
+		if order.Desc {
+			parts[i] = "-" + order.Column
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// Cursor 由一行的排序键生成游标 values 与 Columns 一一对应
+func (k *Keyset) Cursor(values []interface{}) (string, error) {
+	if len(values) != len(k.Orders) {
+		return "", fmt.Errorf("游标取值数量 %d 与排序列数量 %d 不一致", len(values), len(k.Orders))
+	}
+	payload := cursorPayload{Key: k.key(), Values: make([]cursorValue, len(values))}
+	for i, value := range values {
+		switch v := value.(type) {
+		case string:
+			payload.Values[i].Str = &v
+		case int:
+			n := int64(v)
+			payload.Values[i].Int = &n
+		case int32:
+			n := int64(v)
+			payload.Values[i].Int = &n
+		case int64:
+			payload.Values[i].Int = &v
+		case float64:
+			payload.Values[i].Float = &v
+		case time.Time:
+			payload.Values[i].Time = &v
+		case bool:
+			payload.Values[i].Bool = &v
+		default:
+			return "", fmt.Errorf("不支持的游标取值类型 %T", value)
+		}
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func (k *Keyset) decode(cursor string) ([]interface{}, error) {
+	invalid := &ValueError{Param: "cursor", Value: cursor, Expect: "按相同排序返回的 next_cursor"}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, invalid
+	}
+	var payload cursorPayload
+	if err := json.Unmarshal(data, &payload); err != nil || payload.Key != k.key() || len(payload.Values) != len(k.Orders) {
+		return nil, invalid
+	}
+	values := make([]interface{}, len(payload.Values))
+	for i, value := range payload.Values {
+		switch {
+		case value.Str != nil:
+			values[i] = *value.Str
+		case value.Int != nil:
+			values[i] = *value.Int
+		case value.Float != nil:
+			values[i] = *value.Float
+		case value.Time != nil:
+			values[i] = *value.Time
+		case value.Bool != nil:
+			values[i] = *value.Bool
+		default:
+			return nil, invalid
+		}
+	}
+	return values, nil
+}
+
+// NextPage 查询时多取一行用于判断是否还有下一页
+// 返回截掉多取的一行后的结果和下一页的游标 没有下一页时游标为空
+func NextPage[T any](k *Keyset, rows []T, size int, values func(row *T) []interface{}) ([]T, string, error) {
+	if len(rows) <= size {
+		return rows, "", nil
+	}
+	rows = rows[:size]
+	cursor, err := k.Cursor(values(&rows[size-1]))
+	return rows, cursor, err
+}
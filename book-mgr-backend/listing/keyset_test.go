@@ -0,0 +1,175 @@
+package listing
+
+import (
+	"errors"
+	"fmt"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewKeysetAddsTiebreak(t *testing.T) {
+	id := Order{Column: "id"}
+	k := NewKeyset([]Order{{Column: "year", Desc: true}}, id)
+	if got := k.Columns(); !reflect.DeepEqual(got, []string{"year", "id"}) {
+		t.Errorf("Columns() = %v", got)
+	}
+	// 排序中已有兜底列时不再重复添加
+	k = NewKeyset([]Order{{Column: "id", Desc: true}}, id)
+	if len(k.Orders) != 1 || !k.Orders[0].Desc {
+		t.Errorf("Orders = %+v", k.Orders)
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	k := NewKeyset([]Order{
+		{Column: "name"}, {Column: "year", Desc: true}, {Column: "price"},
+		{Column: "created_at"}, {Column: "available"},
+	}, Order{Column: "id"})
+	created := time.Date(2024, 1, 2, 15, 4, 5, 123456789, time.UTC)
+	cursor, err := k.Cursor([]interface{}{"三国演义", 1998, 9.5, created, true, int64(42)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := k.decode(cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 整数统一为 int64 时间保留原类型和精度
+	want := []interface{}{"三国演义", int64(1998), 9.5, created, true, int64(42)}
+	if len(values) != len(want) {
+		t.Fatalf("decode() = %v", values)
+	}
+	for i := range want {
+		if tm, ok := want[i].(time.Time); ok {
+			if got, ok := values[i].(time.Time); !ok || !got.Equal(tm) {
+				t.Errorf("第 %d 个取值 = %#v 期望 %v", i, values[i], tm)
+			}
+			continue
+		}
+		if values[i] != want[i] {
+			t.Errorf("第 %d 个取值 = %#v 期望 %#v", i, values[i], want[i])
+		}
+	}
+}
+
+func TestCursorRejectsWrongValues(t *testing.T) {
+	k := NewKeyset([]Order{{Column: "name"}}, Order{Column: "id"})
+	if _, err := k.Cursor([]interface{}{"a"}); err == nil {
+		t.Error("取值数量不一致时应返回错误")
+	}
+	if _, err := k.Cursor([]interface{}{[]byte("a"), 1}); err == nil {
+		t.Error("不支持的取值类型应返回错误")
+	}
+}
+
+func TestDecodeRejectsMismatchedCursor(t *testing.T) {
+	byName := NewKeyset([]Order{{Column: "name"}}, Order{Column: "id"})
+	cursor, err := byName.Cursor([]interface{}{"a", 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]struct {
+		keyset *Keyset
+		cursor string
+	}{
+		"换了排序列":     {NewKeyset([]Order{{Column: "year"}}, Order{Column: "id"}), cursor},
+		"换了排序方向":    {NewKeyset([]Order{{Column: "name", Desc: true}}, Order{Column: "id"}), cursor},
+		"不是 base64": {byName, "不是游标"},
+		"不是 JSON":   {byName, "bm90LWpzb24"},
+		"空取值":       {byName, "eyJrIjoibmFtZSxpZCIsInYiOlt7fSx7fV19"},
+	}
+	for name, c := range cases {
+		_, err := c.keyset.decode(c.cursor)
+		var valueErr *ValueError
+		if !errors.As(err, &valueErr) || valueErr.Param != "cursor" {
+			t.Errorf("%s: err=%v 期望 cursor 参数错误", name, err)
+		}
+	}
+	if _, err := byName.After(nil, "不是游标"); err == nil {
+		t.Error("After 应拒绝无效的游标")
+	}
+}
+
+func TestNextPage(t *testing.T) {
+	k := NewKeyset(nil, Order{Column: "id"})
+	value := func(row *int) []interface{} { return []interface{}{*row} }
+
+	rows, cursor, err := NextPage(k, []int{1, 2, 3}, 3, value)
+	if err != nil || len(rows) != 3 || cursor != "" {
+		t.Errorf("没有下一页时 rows=%v cursor=%q err=%v", rows, cursor, err)
+	}
+	rows, cursor, err = NextPage(k, []int{1, 2, 3, 4}, 3, value)
+	if err != nil || len(rows) != 3 || cursor == "" {
+		t.Fatalf("有下一页时 rows=%v cursor=%q err=%v", rows, cursor, err)
+	}
+	values, err := k.decode(cursor)
+	if err != nil || values[0] != int64(3) {
+		t.Errorf("游标应指向本页最后一行 values=%v err=%v", values, err)
+	}
+}
+
+type keysetRow struct {
+	Id   int64
+	Year int64
+	Name string
+}
+
+// 按游标翻页应不重不漏地遍历全部行 排序列有重复取值时由兜底列区分
+func TestFetchWalksAllRowsByCursor(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "keyset.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&keysetRow{}); err != nil {
+		t.Fatal(err)
+	}
+	var rows []keysetRow
+	for i := 1; i <= 23; i++ {
+		rows = append(rows, keysetRow{Id: int64(i), Year: int64(2000 + i%4), Name: fmt.Sprintf("book-%02d", i)})
+	}
+	if err := db.Create(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	keyset := NewKeyset([]Order{{Column: "year", Desc: true}}, Order{Column: "id"})
+	values := func(row *keysetRow) []interface{} { return []interface{}{row.Year, row.Id} }
+	seen := map[int64]bool{}
+	var last *keysetRow
+	cursor, pages := "", 0
+	for {
+		list := &List{Query: db.Model(&keysetRow{}), Keyset: keyset, Page: 1, Size: 5, Cursor: cursor}
+		var page []keysetRow
+		envelope, err := Fetch(list, &page, values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if envelope.Total != 23 {
+			t.Errorf("Total = %d", envelope.Total)
+		}
+		for i := range page {
+			row := page[i]
+			if seen[row.Id] {
+				t.Errorf("第 %d 行重复出现", row.Id)
+			}
+			seen[row.Id] = true
+			if last != nil && (row.Year > last.Year || (row.Year == last.Year && row.Id < last.Id)) {
+				t.Errorf("顺序错误: %+v 排在 %+v 之后", row, *last)
+			}
+			last = &row
+		}
+		pages++
+		if cursor = envelope.NextCursor; cursor == "" {
+			break
+		}
+		if pages > 10 {
+			t.Fatal("翻页没有结束")
+		}
+	}
+	if len(seen) != 23 || pages != 5 {
+		t.Errorf("共取到 %d 行 %d 页 期望 23 行 5 页", len(seen), pages)
+	}
+}
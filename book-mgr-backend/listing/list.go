@@ -0,0 +1,56 @@
+package listing
+
+import "gorm.io/gorm"
+
+// List 列表查询 计数和分页基于同一个查询 保证总数与分页结果使用相同的筛选条件
+type List struct {
+	Query  *gorm.DB                   // 只包含来源表和筛选条件 不含排序和分页
+	Select func(db *gorm.DB) *gorm.DB // 只对分页查询生效的设置 如查询列和预加载 可为空
+	Keyset *Keyset
+	Page   int
+	Size   int
+	Cursor string // 提供时按游标翻页 忽略 Page
+}
+
+// Envelope 列表接口统一返回的分页信息
+type Envelope struct {
+	Total      int64  `json:"total"`
+	Page       int    `json:"page"` // 按游标翻页时为0
+	Size       int    `json:"size"`
+	PageCount  int64  `json:"page_count"`
+	NextCursor string `json:"next_cursor"` // 没有下一页时为空
+}
+
+// Fetch 统计总数并查询一页 values 返回一行在各排序列上的取值 用于生成下一页的游标
+func Fetch[T any](list *List, rows *[]T, values func(row *T) []interface{}) (*Envelope, error) {
+	base := list.Query.Session(&gorm.Session{})
+	envelope := &Envelope{Page: list.Page, Size: list.Size}
+	if err := base.Count(&envelope.Total).Error; err != nil {
+		return nil, err
+	}
+	envelope.PageCount = (envelope.Total + int64(list.Size) - 1) / int64(list.Size)
+
+	query := base
+	if list.Select != nil {
+		query = list.Select(query)
+	}
+	if list.Cursor != "" {
+		var err error
+		if query, err = list.Keyset.After(query, list.Cursor); err != nil {
+			return nil, err
+		}
+		envelope.Page = 0
+	} else {
+		query = query.Offset((list.Page - 1) * list.Size)
+	}
+	// 多取一行用于判断是否还有下一页
+	if err := list.Keyset.OrderBy(query).Limit(list.Size + 1).Find(rows).Error; err != nil {
+		return nil, err
+	}
+	var err error
+	*rows, envelope.NextCursor, err = NextPage(list.Keyset, *rows, list.Size, values)
+	if err != nil {
+		return nil, err
+	}
+	return envelope, nil
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"book-mgr-backend/dao"
+	"book-mgr-backend/handler"
+	"book-mgr-backend/model"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+// authenticate 解析令牌并写入用户身份 失败时中止请求并返回 false
+func authenticate(context *gin.Context) bool {
+	authHeader := context.GetHeader("Authorization")
+	tokenString, found := strings.CutPrefix(authHeader, "Bearer ")
+	if !found || strings.TrimSpace(tokenString) == "" {
+		context.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"code": http.StatusUnauthorized,
+			"msg":  "未登录或缺少令牌",
+		})
+		return false
+	}
+
+	claims, err := ParseToken(strings.TrimSpace(tokenString))
+	if err != nil {
+		context.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"code": http.StatusUnauthorized,
+			"msg":  "令牌无效或已过期",
+		})
+		return false
+	}
+
+	// 令牌中的角色必须与用户当前的角色一致 被降级或删除的用户需要重新登录
+	var user model.User
+	if err := dao.Db.Select("id", "role").Where("id = ?", claims.UserId).Take(&user).Error; err != nil || user.Role != claims.Role {
+		context.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"code": http.StatusUnauthorized,
+			"msg":  "用户角色已变更 请重新登录",
+		})
+		return false
+	}
+
+	context.Set(handler.CtxUserIdKey, claims.UserId)
+	context.Set(handler.CtxRoleKey, claims.Role)
+	return true
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// Cors 跨域处理 allowedOrigins 中包含 "*" 时允许任意来源
+func Cors(allowedOrigins []string) gin.HandlerFunc {
+	allowAll := false
+	allowed := make(map[string]bool, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		if origin == "*" {
+			allowAll = true
+		}
+		allowed[origin] = true
+	}
+
+	return func(context *gin.Context) {
+		origin := context.GetHeader("Origin")
+		if allowAll {
+			context.Header("Access-Control-Allow-Origin", "*")
+		} else if origin != "" && allowed[origin] {
+			context.Header("Access-Control-Allow-Origin", origin)
+			context.Header("Vary", "Origin")
+		}
+		context.Header("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE, PATCH")
+		context.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, Idempotency-Key")
+		context.Header("Access-Control-Expose-Headers", "Idempotent-Replayed")
+		if context.Request.Method == "OPTIONS" {
+			context.AbortWithStatus(http.StatusOK)
+			return
+		}
+		context.Next()
+	}
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"book-mgr-backend/dao"
+	"book-mgr-backend/handler"
+	"book-mgr-backend/service"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotencyReplayedHeader = "Idempotent-Replayed" // 重放的响应带有该响应头
+)
+
+// responseRecorder 在写出响应的同时保留一份响应体
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotent 请求带有 Idempotency-Key 时 有效期内的重试直接返回首次的响应
+// 未带该请求头的请求照常处理
+func Idempotent() gin.HandlerFunc {
+	return func(context *gin.Context) {
+		key := strings.TrimSpace(context.GetHeader(IdempotencyKeyHeader))
+		if key == "" {
+			context.Next()
+			return
+		}
+
+		body, err := io.ReadAll(context.Request.Body)
+		if err != nil {
+			context.AbortWithStatusJSON(http.StatusOK, gin.H{
+				"code": http.StatusBadRequest,
+				"msg":  "读取请求失败",
+			})
+			return
+		}
+		context.Request.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+
+		record, replay, err := service.BeginIdempotent(dao.Db, handler.GetUserIdFromContext(context),
+			context.Request.Method, context.FullPath(), key, hex.EncodeToString(sum[:]), time.Now())
+		if err != nil {
+			handler.RespondServiceError(context, err)
+			context.Abort()
+			return
+		}
+		if replay {
+			context.Header(IdempotencyReplayedHeader, "true")
+			context.Data(record.ResponseCode, "application/json; charset=utf-8", []byte(record.ResponseBody))
+			context.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: context.Writer}
+		context.Writer = recorder
+		context.Next()
+
+		// 服务端错误不保存 客户端可以用同一个键重试
+		if recorder.Status() >= http.StatusInternalServerError || responseCode(recorder.body.Bytes()) >= http.StatusInternalServerError {
+			if err := service.AbandonIdempotent(dao.Db, record); err != nil {
+				log.Println("删除幂等键失败 err: ", err)
+			}
+			return
+		}
+		if err := service.CompleteIdempotent(dao.Db, record, recorder.Status(), recorder.body.Bytes(), time.Now()); err != nil {
+			log.Println("保存幂等响应失败 err: ", err)
+		}
+	}
+}
+
+// responseCode 取出响应体中的业务状态码
+func responseCode(body []byte) int {
+	var payload struct {
+		Code int `json:"code"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return 0
+	}
+	return payload.Code
+}
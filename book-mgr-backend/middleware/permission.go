@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"book-mgr-backend/handler"
+	"book-mgr-backend/model"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sort"
+)
+
+// Permission 访问某一类接口所需的权限
+type Permission string
+
+const (
+	PermPublic      Permission = "public"       // 无需登录即可访问
+	PermSummaryRead Permission = "summary:read" // 查看管理端统计
+	PermBookRead    Permission = "book:read"    // 查看图书
+	PermBookWrite   Permission = "book:write"   // 新增和修改图书
+	PermBookDelete  Permission = "book:delete"  // 删除图书
+	PermUserRead    Permission = "user:read"    // 查看用户列表
+	PermHistoryRead Permission = "history:read" // 查看全部借阅记录
+	PermLoanSelf    Permission = "loan:self"    // 借阅 归还 预约和查看自己的记录
+	PermHoldManage  Permission = "hold:manage"  // 管理预约队列
+	PermFineManage  Permission = "fine:manage"  // 查看罚款 登记缴费和减免
+	PermCirculation Permission = "circulation"  // 在服务台为读者办理借出和归还
+)
+
+// rolePermissions 角色到权限的映射 未列出的角色没有任何权限
+var rolePermissions = map[string][]Permission{
+	model.RoleAdmin: {
+		PermSummaryRead, PermBookRead, PermBookWrite, PermBookDelete,
+		PermUserRead, PermHistoryRead, PermLoanSelf, PermHoldManage, PermFineManage,
+		PermCirculation,
+	},
+	model.RoleLibrarian: {
+		PermSummaryRead, PermBookRead, PermBookWrite,
+		PermUserRead, PermHistoryRead, PermHoldManage, PermFineManage,
+		PermCirculation,
+	},
+	model.RoleReader: {
+		PermBookRead, PermLoanSelf,
+	},
+}
+
+// HasPermission 判断角色是否拥有指定权限
+func HasPermission(role string, perm Permission) bool {
+	if perm == PermPublic {
+		return true
+	}
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// CanLoginAs 判断用户能否从指定入口登录 管理端入口对管理员和图书馆员开放
+func CanLoginAs(role, portal string) bool {
+	if portal == model.RoleAdmin {
+		return role == model.RoleAdmin || role == model.RoleLibrarian
+	}
+	return role == portal
+}
+
+// RoutePolicy 路由到所需权限的声明表 键的格式为 "METHOD /完整/路径"
+type RoutePolicy map[string]Permission
+
+func routeKey(method, path string) string {
+	return method + " " + path
+}
+
+// Verify 检查已注册的每一条路由都在声明表中 防止新增接口时遗漏权限配置
+func (p RoutePolicy) Verify(routes gin.RoutesInfo) error {
+	var missing []string
+	for _, route := range routes {
+		if _, ok := p[routeKey(route.Method, route.Path)]; !ok {
+			missing = append(missing, routeKey(route.Method, route.Path))
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("以下路由未配置访问权限: %v", missing)
+	}
+	return nil
+}
+
+// Guard 根据声明表对每个请求进行鉴权 未在表中声明的路由一律拒绝
+func Guard(policy RoutePolicy) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		// 未匹配到路由 交给 gin 返回 404
+		if context.FullPath() == "" {
+			context.Next()
+			return
+		}
+
+		perm, ok := policy[routeKey(context.Request.Method, context.FullPath())]
+		if !ok {
+			context.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"code": http.StatusForbidden,
+				"msg":  "接口未配置访问权限",
+			})
+			return
+		}
+		if perm == PermPublic {
+			context.Next()
+			return
+		}
+
+		if !authenticate(context) {
+			return
+		}
+		if !HasPermission(handler.GetRoleFromContext(context), perm) {
+			context.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"code": http.StatusForbidden,
+				"msg":  "没有访问权限",
+			})
+			return
+		}
+		context.Next()
+	}
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"book-mgr-backend/config"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"time"
+)
+
+const tokenIssuer = "book-mgr-backend" // 签发者
+
+var (
+	ErrInvalidToken = errors.New("无效的令牌")
+	ErrNoSecret     = errors.New("未配置令牌签名密钥 auth.token_secret")
+)
+
+// signingKey 返回运维配置的签名密钥 未配置时拒绝签发和校验令牌
+func signingKey() ([]byte, error) {
+	if config.Conf.Auth.TokenSecret == "" {
+		return nil, ErrNoSecret
+	}
+	return []byte(config.Conf.Auth.TokenSecret), nil
+}
+
+// Claims 令牌中携带的用户身份信息
+type Claims struct {
+	UserId int64  `json:"user_id"`
+	Role   string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// IssueToken 为用户签发访问令牌 返回令牌和过期时间
+func IssueToken(userId int64, role string) (string, time.Time, error) {
+	key, err := signingKey()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	now := time.Now()
+	expiresAt := now.Add(config.Conf.Auth.TokenExpire)
+	claims := Claims{
+		UserId: userId,
+		Role:   role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+// ParseToken 校验令牌的签名和有效期 并取出其中的身份信息
+func ParseToken(tokenString string) (*Claims, error) {
+	key, err := signingKey()
+	if err != nil {
+		return nil, err
+	}
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer(tokenIssuer))
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	if claims.UserId <= 0 {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
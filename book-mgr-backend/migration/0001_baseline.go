@@ -0,0 +1,73 @@
+package migration
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// 以下结构是基线迁移时三张表的快照 之后模型的变更需要新增迁移 不要修改这里
+
+type bookV1 struct {
+	gorm.Model
+	Id        int64 `gorm:"primaryKey;AUTO_INCREMENT"`
+	Name      string
+	Publisher string
+	Year      int32
+	Remark    string `gorm:"type:TEXT"`
+	Author    string
+	ISBN      string
+	Price     float64
+	Residue   int64
+	CoverUrl  string `gorm:"type:TEXT"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt
+}
+
+func (bookV1) TableName() string {
+	return "t_books"
+}
+
+type userV1 struct {
+	gorm.Model
+	Id        int64 `gorm:"primary_key;AUTO_INCREMENT"`
+	Role      string
+	Email     string
+	Password  string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt
+}
+
+func (userV1) TableName() string {
+	return "t_user"
+}
+
+type historyV1 struct {
+	gorm.Model
+	Id         int64 `gorm:"primary_key;AUTO_INCREMENT"`
+	BorrowId   string
+	UserId     int64
+	BookId     int64
+	BorrowedAt *time.Time
+	IsBack     bool
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	DeletedAt  gorm.DeletedAt
+}
+
+func (historyV1) TableName() string {
+	return "t_history"
+}
+
+// 基线迁移 已经通过 AutoMigrate 建好表的数据库执行时只会补齐缺失的列
+var m0001Baseline = Migration{
+	Version: 1,
+	Name:    "baseline",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&bookV1{}, &userV1{}, &historyV1{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&historyV1{}, &userV1{}, &bookV1{})
+	},
+}
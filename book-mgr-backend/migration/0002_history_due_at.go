@@ -0,0 +1,57 @@
+package migration
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// loanDaysV2 回填时使用的借阅期限 固定为发布时的默认值 不读取部署时的配置
+const loanDaysV2 = 30
+
+type historyV2 struct {
+	Id         int64 `gorm:"primaryKey"`
+	BorrowedAt *time.Time
+	DueAt      *time.Time `gorm:"index"`
+}
+
+func (historyV2) TableName() string {
+	return "t_history"
+}
+
+// 借阅记录增加应还日期 已有记录按 loanDaysV2 回填
+var m0002HistoryDueAt = Migration{
+	Version: 2,
+	Name:    "history_due_at",
+	Up: func(tx *gorm.DB) error {
+		if !tx.Migrator().HasColumn(&historyV2{}, "DueAt") {
+			if err := tx.Migrator().AddColumn(&historyV2{}, "DueAt"); err != nil {
+				return err
+			}
+		}
+		if !tx.Migrator().HasIndex(&historyV2{}, "DueAt") {
+			if err := tx.Migrator().CreateIndex(&historyV2{}, "DueAt"); err != nil {
+				return err
+			}
+		}
+
+		loanPeriod := loanDaysV2 * 24 * time.Hour
+		var rows []historyV2
+		return tx.Where("due_at IS NULL AND borrowed_at IS NOT NULL").FindInBatches(&rows, 500, func(batch *gorm.DB, _ int) error {
+			for _, row := range rows {
+				dueAt := row.BorrowedAt.Add(loanPeriod)
+				if err := tx.Model(&historyV2{}).Where("id = ?", row.Id).Update("due_at", dueAt).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+	},
+	Down: func(tx *gorm.DB) error {
+		if tx.Migrator().HasIndex(&historyV2{}, "DueAt") {
+			if err := tx.Migrator().DropIndex(&historyV2{}, "DueAt"); err != nil {
+				return err
+			}
+		}
+		return tx.Migrator().DropColumn(&historyV2{}, "DueAt")
+	},
+}
@@ -0,0 +1,26 @@
+package migration
+
+import "gorm.io/gorm"
+
+type historyV3 struct {
+	RenewCount int `gorm:"not null;default:0"`
+}
+
+func (historyV3) TableName() string {
+	return "t_history"
+}
+
+// 借阅记录增加续借次数
+var m0003HistoryRenewCount = Migration{
+	Version: 3,
+	Name:    "history_renew_count",
+	Up: func(tx *gorm.DB) error {
+		if tx.Migrator().HasColumn(&historyV3{}, "RenewCount") {
+			return nil
+		}
+		return tx.Migrator().AddColumn(&historyV3{}, "RenewCount")
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropColumn(&historyV3{}, "RenewCount")
+	},
+}
@@ -0,0 +1,34 @@
+package migration
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+type holdV4 struct {
+	Id        int64  `gorm:"primaryKey;AUTO_INCREMENT"`
+	UserId    int64  `gorm:"index"`
+	BookId    int64  `gorm:"index"`
+	Status    string `gorm:"size:16;index"`
+	ReadyAt   *time.Time
+	ExpiresAt *time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt
+}
+
+func (holdV4) TableName() string {
+	return "t_hold"
+}
+
+// 新增预约队列表
+var m0004Hold = Migration{
+	Version: 4,
+	Name:    "hold",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&holdV4{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&holdV4{})
+	},
+}
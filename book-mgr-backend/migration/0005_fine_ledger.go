@@ -0,0 +1,33 @@
+package migration
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+type fineEntryV5 struct {
+	Id         int64  `gorm:"primaryKey;AUTO_INCREMENT"`
+	UserId     int64  `gorm:"index"`
+	HistoryId  *int64 `gorm:"index"`
+	Kind       string `gorm:"size:16"`
+	Amount     int64
+	OperatorId int64
+	Remark     string
+	CreatedAt  time.Time
+}
+
+func (fineEntryV5) TableName() string {
+	return "t_fine_ledger"
+}
+
+// 新增罚款流水表
+var m0005FineLedger = Migration{
+	Version: 5,
+	Name:    "fine_ledger",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&fineEntryV5{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&fineEntryV5{})
+	},
+}
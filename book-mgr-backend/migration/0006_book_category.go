@@ -0,0 +1,36 @@
+package migration
+
+import "gorm.io/gorm"
+
+type bookV6 struct {
+	Category string `gorm:"size:64;index"`
+}
+
+func (bookV6) TableName() string {
+	return "t_books"
+}
+
+// 图书增加分类 用于分类借阅上限和筛选
+var m0006BookCategory = Migration{
+	Version: 6,
+	Name:    "book_category",
+	Up: func(tx *gorm.DB) error {
+		if !tx.Migrator().HasColumn(&bookV6{}, "Category") {
+			if err := tx.Migrator().AddColumn(&bookV6{}, "Category"); err != nil {
+				return err
+			}
+		}
+		if !tx.Migrator().HasIndex(&bookV6{}, "Category") {
+			return tx.Migrator().CreateIndex(&bookV6{}, "Category")
+		}
+		return nil
+	},
+	Down: func(tx *gorm.DB) error {
+		if tx.Migrator().HasIndex(&bookV6{}, "Category") {
+			if err := tx.Migrator().DropIndex(&bookV6{}, "Category"); err != nil {
+				return err
+			}
+		}
+		return tx.Migrator().DropColumn(&bookV6{}, "Category")
+	},
+}
@@ -0,0 +1,161 @@
+package migration
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+)
+
+type copyV7 struct {
+	Id         int64  `gorm:"primaryKey;AUTO_INCREMENT"`
+	BookId     int64  `gorm:"index"`
+	Barcode    string `gorm:"size:64;uniqueIndex"`
+	Status     string `gorm:"size:16;index"`
+	AcquiredAt *time.Time
+	Remark     string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	DeletedAt  gorm.DeletedAt
+}
+
+func (copyV7) TableName() string {
+	return "t_copy"
+}
+
+type historyV7 struct {
+	Id     int64
+	BookId int64
+	CopyId int64 `gorm:"index;not null;default:0"`
+	IsBack bool
+}
+
+func (historyV7) TableName() string {
+	return "t_history"
+}
+
+type holdV7 struct {
+	Id     int64
+	BookId int64
+	CopyId int64 `gorm:"index;not null;default:0"`
+	Status string
+}
+
+func (holdV7) TableName() string {
+	return "t_hold"
+}
+
+type bookV7 struct {
+	Id        int64
+	Residue   int64
+	CreatedAt time.Time
+}
+
+func (bookV7) TableName() string {
+	return "t_books"
+}
+
+// 按册管理馆藏 借阅记录和预约指向具体的单册
+// 已有的图书按库存 未归还的借阅和待取书的预约补齐单册
+var m0007Copy = Migration{
+	Version: 7,
+	Name:    "copy",
+	Up: func(tx *gorm.DB) error {
+		if err := tx.AutoMigrate(&copyV7{}); err != nil {
+			return err
+		}
+		for _, model := range []interface{}{&historyV7{}, &holdV7{}} {
+			if !tx.Migrator().HasColumn(model, "CopyId") {
+				if err := tx.Migrator().AddColumn(model, "CopyId"); err != nil {
+					return err
+				}
+			}
+			if !tx.Migrator().HasIndex(model, "CopyId") {
+				if err := tx.Migrator().CreateIndex(model, "CopyId"); err != nil {
+					return err
+				}
+			}
+		}
+
+		var books []bookV7
+		if err := tx.Unscoped().Find(&books).Error; err != nil {
+			return err
+		}
+		for _, book := range books {
+			if err := backfillCopies(tx, book); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Down: func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&historyV7{}, &holdV7{}} {
+			if tx.Migrator().HasIndex(model, "CopyId") {
+				if err := tx.Migrator().DropIndex(model, "CopyId"); err != nil {
+					return err
+				}
+			}
+			if err := tx.Migrator().DropColumn(model, "CopyId"); err != nil {
+				return err
+			}
+		}
+		return tx.Migrator().DropTable(&copyV7{})
+	},
+}
+
+// backfillCopies 为一本书补齐单册 已有单册的图书跳过
+func backfillCopies(tx *gorm.DB, book bookV7) error {
+	var existing int64
+	if err := tx.Unscoped().Model(&copyV7{}).Where("book_id = ?", book.Id).Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		return nil
+	}
+
+	seq := int64(0)
+	newCopy := func(status string) (*copyV7, error) {
+		seq++
+		item := &copyV7{
+			BookId:     book.Id,
+			Barcode:    fmt.Sprintf("%08d%04d", book.Id, seq),
+			Status:     status,
+			AcquiredAt: &book.CreatedAt,
+		}
+		return item, tx.Create(item).Error
+	}
+
+	var loans []historyV7
+	if err := tx.Where("book_id = ? AND is_back = ? AND deleted_at IS NULL", book.Id, false).Find(&loans).Error; err != nil {
+		return err
+	}
+	for _, loan := range loans {
+		item, err := newCopy("on_loan")
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&historyV7{}).Where("id = ?", loan.Id).Update("copy_id", item.Id).Error; err != nil {
+			return err
+		}
+	}
+
+	var holds []holdV7
+	if err := tx.Where("book_id = ? AND status = ? AND deleted_at IS NULL", book.Id, "ready").Find(&holds).Error; err != nil {
+		return err
+	}
+	for _, hold := range holds {
+		item, err := newCopy("on_hold")
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&holdV7{}).Where("id = ?", hold.Id).Update("copy_id", item.Id).Error; err != nil {
+			return err
+		}
+	}
+
+	for i := int64(0); i < book.Residue; i++ {
+		if _, err := newCopy("available"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package migration
+
+import (
+	"book-mgr-backend/borrowid"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+type historyV8 struct {
+	Id        int64  `gorm:"primaryKey"`
+	BorrowId  string `gorm:"size:64;uniqueIndex"`
+	CreatedAt time.Time
+}
+
+func (historyV8) TableName() string {
+	return "t_history"
+}
+
+// 借阅号增加唯一索引 旧格式下重复的借阅号除最早的一条外重新生成
+var m0008HistoryBorrowIdUnique = Migration{
+	Version: 8,
+	Name:    "history_borrow_id_unique",
+	Up: func(tx *gorm.DB) error {
+		// SQLite 的文本列不限长度 其他数据库需要定长才能建索引
+		if tx.Dialector.Name() != "sqlite" {
+			if err := tx.Migrator().AlterColumn(&historyV8{}, "BorrowId"); err != nil {
+				return err
+			}
+		}
+
+		var duplicated []string
+		if err := tx.Unscoped().Model(&historyV8{}).
+			Group("borrow_id").Having("COUNT(*) > 1").
+			Pluck("borrow_id", &duplicated).Error; err != nil {
+			return err
+		}
+		for _, borrowId := range duplicated {
+			var rows []historyV8
+			if err := tx.Unscoped().Where("borrow_id = ?", borrowId).Order("id ASC").Find(&rows).Error; err != nil {
+				return err
+			}
+			for _, row := range rows[1:] {
+				newId, err := uniqueBorrowIdV8(tx, row.CreatedAt)
+				if err != nil {
+					return err
+				}
+				if err := tx.Unscoped().Model(&historyV8{}).Where("id = ?", row.Id).Update("borrow_id", newId).Error; err != nil {
+					return err
+				}
+				log.Printf("借阅记录 %d 的借阅号 %s 重复 已改为 %s", row.Id, borrowId, newId)
+			}
+		}
+
+		if !tx.Migrator().HasIndex(&historyV8{}, "BorrowId") {
+			return tx.Migrator().CreateIndex(&historyV8{}, "BorrowId")
+		}
+		return nil
+	},
+	Down: func(tx *gorm.DB) error {
+		if tx.Migrator().HasIndex(&historyV8{}, "BorrowId") {
+			return tx.Migrator().DropIndex(&historyV8{}, "BorrowId")
+		}
+		return nil
+	},
+}
+
+func uniqueBorrowIdV8(tx *gorm.DB, createdAt time.Time) (string, error) {
+	for {
+		id, err := borrowid.New(createdAt)
+		if err != nil {
+			return "", err
+		}
+		var count int64
+		if err := tx.Unscoped().Model(&historyV8{}).Where("borrow_id = ?", id).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return id, nil
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package migration
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+type idempotencyKeyV9 struct {
+	Id           int64  `gorm:"primaryKey;AUTO_INCREMENT"`
+	UserId       int64  `gorm:"uniqueIndex:idx_idempotency_scope"`
+	Method       string `gorm:"size:8;uniqueIndex:idx_idempotency_scope"`
+	Path         string `gorm:"size:128;uniqueIndex:idx_idempotency_scope"`
+	Key          string `gorm:"size:128;uniqueIndex:idx_idempotency_scope"`
+	RequestHash  string `gorm:"size:64"`
+	Status       string `gorm:"size:16"`
+	ResponseCode int
+	ResponseBody string    `gorm:"type:TEXT"`
+	ExpiresAt    time.Time `gorm:"index"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (idempotencyKeyV9) TableName() string {
+	return "t_idempotency_key"
+}
+
+// 新增幂等键表 保存带 Idempotency-Key 请求的首次响应
+var m0009IdempotencyKey = Migration{
+	Version: 9,
+	Name:    "idempotency_key",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&idempotencyKeyV9{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&idempotencyKeyV9{})
+	},
+}
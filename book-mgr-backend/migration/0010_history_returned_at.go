@@ -0,0 +1,31 @@
+package migration
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+type historyV10 struct {
+	ReturnedAt *time.Time
+}
+
+func (historyV10) TableName() string {
+	return "t_history"
+}
+
+// 借阅记录增加归还时间 已归还的记录以最后更新时间回填
+var m0010HistoryReturnedAt = Migration{
+	Version: 10,
+	Name:    "history_returned_at",
+	Up: func(tx *gorm.DB) error {
+		if !tx.Migrator().HasColumn(&historyV10{}, "ReturnedAt") {
+			if err := tx.Migrator().AddColumn(&historyV10{}, "ReturnedAt"); err != nil {
+				return err
+			}
+		}
+		return tx.Exec("UPDATE t_history SET returned_at = updated_at WHERE is_back = ? AND returned_at IS NULL", true).Error
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropColumn(&historyV10{}, "ReturnedAt")
+	},
+}
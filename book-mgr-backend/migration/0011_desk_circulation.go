@@ -0,0 +1,74 @@
+package migration
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+)
+
+type userV11 struct {
+	Id     int64
+	CardNo *string `gorm:"size:32;uniqueIndex"`
+}
+
+func (userV11) TableName() string {
+	return "t_user"
+}
+
+type historyV11 struct {
+	OperatorId       int64 `gorm:"not null;default:0"`
+	ReturnOperatorId int64 `gorm:"not null;default:0"`
+}
+
+func (historyV11) TableName() string {
+	return "t_history"
+}
+
+// 用户增加借书证号 已有用户按id补发 借阅记录增加服务台经办人
+var m0011DeskCirculation = Migration{
+	Version: 11,
+	Name:    "desk_circulation",
+	Up: func(tx *gorm.DB) error {
+		if !tx.Migrator().HasColumn(&userV11{}, "CardNo") {
+			if err := tx.Migrator().AddColumn(&userV11{}, "CardNo"); err != nil {
+				return err
+			}
+		}
+		var users []userV11
+		if err := tx.Where("card_no IS NULL").Find(&users).Error; err != nil {
+			return err
+		}
+		for _, user := range users {
+			if err := tx.Model(&userV11{}).Where("id = ?", user.Id).
+				Update("card_no", fmt.Sprintf("RC%08d", user.Id)).Error; err != nil {
+				return err
+			}
+		}
+		if !tx.Migrator().HasIndex(&userV11{}, "CardNo") {
+			if err := tx.Migrator().CreateIndex(&userV11{}, "CardNo"); err != nil {
+				return err
+			}
+		}
+
+		for _, field := range []string{"OperatorId", "ReturnOperatorId"} {
+			if !tx.Migrator().HasColumn(&historyV11{}, field) {
+				if err := tx.Migrator().AddColumn(&historyV11{}, field); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	},
+	Down: func(tx *gorm.DB) error {
+		for _, field := range []string{"OperatorId", "ReturnOperatorId"} {
+			if err := tx.Migrator().DropColumn(&historyV11{}, field); err != nil {
+				return err
+			}
+		}
+		if tx.Migrator().HasIndex(&userV11{}, "CardNo") {
+			if err := tx.Migrator().DropIndex(&userV11{}, "CardNo"); err != nil {
+				return err
+			}
+		}
+		return tx.Migrator().DropColumn(&userV11{}, "CardNo")
+	},
+}
@@ -0,0 +1,28 @@
+package migration
+
+import "gorm.io/gorm"
+
+type historyV12 struct {
+	Outcome string `gorm:"size:16"`
+}
+
+func (historyV12) TableName() string {
+	return "t_history"
+}
+
+// 借阅记录增加结束方式 区分正常归还 遗失和损坏 已归还的记录回填为正常归还
+var m0012HistoryOutcome = Migration{
+	Version: 12,
+	Name:    "history_outcome",
+	Up: func(tx *gorm.DB) error {
+		if !tx.Migrator().HasColumn(&historyV12{}, "Outcome") {
+			if err := tx.Migrator().AddColumn(&historyV12{}, "Outcome"); err != nil {
+				return err
+			}
+		}
+		return tx.Exec("UPDATE t_history SET outcome = ? WHERE is_back = ? AND (outcome IS NULL OR outcome = '')", "returned", true).Error
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropColumn(&historyV12{}, "Outcome")
+	},
+}
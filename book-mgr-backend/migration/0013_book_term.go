@@ -0,0 +1,159 @@
+package migration
+
+import (
+	"gorm.io/gorm"
+	"unicode"
+)
+
+type bookTermV13 struct {
+	Id     int64  `gorm:"primaryKey;AUTO_INCREMENT"`
+	BookId int64  `gorm:"index"`
+	Field  string `gorm:"size:16"`
+	Term   string `gorm:"size:64;index"`
+	Weight int64
+}
+
+func (bookTermV13) TableName() string {
+	return "t_book_term"
+}
+
+type bookV13 struct {
+	Id        int64
+	Name      string
+	Publisher string
+	Remark    string
+	Author    string
+	Category  string
+	ISBN      string
+}
+
+func (bookV13) TableName() string {
+	return "t_books"
+}
+
+// 书目全文索引 为已有图书建立索引 字段权重与建表时的检索规则一致
+var m0013BookTerm = Migration{
+	Version: 13,
+	Name:    "book_term",
+	Up: func(tx *gorm.DB) error {
+		if err := tx.AutoMigrate(&bookTermV13{}); err != nil {
+			return err
+		}
+		var books []bookV13
+		if err := tx.Where("deleted_at IS NULL").Find(&books).Error; err != nil {
+			return err
+		}
+		for _, book := range books {
+			if err := tx.Where("book_id = ?", book.Id).Delete(&bookTermV13{}).Error; err != nil {
+				return err
+			}
+			rows := bookTermsV13(book)
+			if len(rows) == 0 {
+				continue
+			}
+			if err := tx.CreateInBatches(rows, 200).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&bookTermV13{})
+	},
+}
+
+func bookTermsV13(book bookV13) []bookTermV13 {
+	fields := []struct {
+		name   string
+		weight int64
+		value  string
+	}{
+		{"name", 8, book.Name},
+		{"author", 5, book.Author},
+		{"isbn", 5, book.ISBN},
+		{"publisher", 3, book.Publisher},
+		{"category", 3, book.Category},
+		{"remark", 1, book.Remark},
+	}
+	var rows []bookTermV13
+	for _, field := range fields {
+		counts := map[string]int64{}
+		var order []string
+		for _, term := range termsV13(field.value) {
+			if runes := []rune(term); len(runes) > 64 {
+				term = string(runes[:64])
+			}
+			if counts[term] == 0 {
+				order = append(order, term)
+			}
+			counts[term]++
+		}
+		for _, term := range order {
+			rows = append(rows, bookTermV13{BookId: book.Id, Field: field.name, Term: term, Weight: field.weight * counts[term]})
+		}
+	}
+	return rows
+}
+
+// 以下为发布该迁移时的分词规则 分词规则以后的调整不影响该迁移的结果
+// 需要按新规则重建索引时执行 server reindex
+
+func termsV13(text string) []string {
+	var terms []string
+	for _, run := range runsV13(text) {
+		if !run.ideographic {
+			terms = append(terms, string(run.text))
+			continue
+		}
+		for i := range run.text {
+			terms = append(terms, string(run.text[i]))
+			if i+1 < len(run.text) {
+				terms = append(terms, string(run.text[i:i+2]))
+			}
+		}
+	}
+	return terms
+}
+
+type textRunV13 struct {
+	text        []rune
+	ideographic bool
+}
+
+func runsV13(text string) []textRunV13 {
+	var result []textRunV13
+	var current []rune
+	currentIdeo := false
+	flush := func() {
+		if len(current) > 0 {
+			result = append(result, textRunV13{text: current, ideographic: currentIdeo})
+			current = nil
+		}
+	}
+	for _, r := range text {
+		r = unicode.ToLower(r)
+		switch {
+		case isIdeographicV13(r):
+			if !currentIdeo {
+				flush()
+			}
+			currentIdeo = true
+			current = append(current, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if currentIdeo {
+				flush()
+			}
+			currentIdeo = false
+			current = append(current, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return result
+}
+
+func isIdeographicV13(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
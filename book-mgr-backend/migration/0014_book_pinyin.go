@@ -0,0 +1,55 @@
+package migration
+
+import (
+	"gorm.io/gorm"
+	"log"
+)
+
+type bookV14 struct {
+	Id             int64
+	Name           string
+	Author         string
+	NamePinyin     string `gorm:"size:255"`
+	NameInitials   string `gorm:"size:255"`
+	AuthorPinyin   string `gorm:"size:255"`
+	AuthorInitials string `gorm:"size:255"`
+}
+
+func (bookV14) TableName() string {
+	return "t_books"
+}
+
+// 图书增加书名和作者的拼音检索键
+var m0014BookPinyin = Migration{
+	Version: 14,
+	Name:    "book_pinyin",
+	Up: func(tx *gorm.DB) error {
+		for _, field := range []string{"NamePinyin", "NameInitials", "AuthorPinyin", "AuthorInitials"} {
+			if !tx.Migrator().HasColumn(&bookV14{}, field) {
+				if err := tx.Migrator().AddColumn(&bookV14{}, field); err != nil {
+					return err
+				}
+			}
+		}
+		// 拼音键依赖拼音库的词典 随依赖升级而变化 不在迁移中生成
+		// 已有图书由 server reindex 按当前的拼音规则生成
+		var count int64
+		if err := tx.Model(&bookV14{}).Where("deleted_at IS NULL").Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			log.Printf("已有 %d 本图书 请执行 server reindex 生成拼音检索键", count)
+		}
+		return nil
+	},
+	Down: func(tx *gorm.DB) error {
+		for _, field := range []string{"NamePinyin", "NameInitials", "AuthorPinyin", "AuthorInitials"} {
+			if tx.Migrator().HasColumn(&bookV14{}, field) {
+				if err := tx.Migrator().DropColumn(&bookV14{}, field); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	},
+}
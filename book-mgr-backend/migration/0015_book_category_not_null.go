@@ -0,0 +1,49 @@
+package migration
+
+import "gorm.io/gorm"
+
+type bookV15 struct {
+	Category string `gorm:"size:64;not null;default:''"`
+}
+
+func (bookV15) TableName() string {
+	return "t_books"
+}
+
+// 图书分类改为非空 空值回填为空字符串
+// 分类为 NULL 时既匹配不到分类借阅上限 按分类排序的游标翻页也会在页边界漏掉这些图书
+var m0015BookCategoryNotNull = Migration{
+	Version: 15,
+	Name:    "book_category_not_null",
+	Up: func(tx *gorm.DB) error {
+		if err := tx.Exec("UPDATE t_books SET category = '' WHERE category IS NULL").Error; err != nil {
+			return err
+		}
+		return alterBookColumn(tx, &bookV15{}, "Category")
+	},
+	Down: func(tx *gorm.DB) error {
+		return alterBookColumn(tx, &bookV6{}, "Category")
+	},
+}
+
+// alterBookColumn 修改 t_books 的列定义
+// SQLite 修改列时会重建表 重建前记下表上的索引 重建后重新创建
+func alterBookColumn(tx *gorm.DB, model interface{}, field string) error {
+	if tx.Dialector.Name() != "sqlite" {
+		return tx.Migrator().AlterColumn(model, field)
+	}
+	var indexes []string
+	if err := tx.Raw("SELECT sql FROM sqlite_master WHERE type = ? AND tbl_name = ? AND sql IS NOT NULL", "index", "t_books").
+		Scan(&indexes).Error; err != nil {
+		return err
+	}
+	if err := tx.Migrator().AlterColumn(model, field); err != nil {
+		return err
+	}
+	for _, index := range indexes {
+		if err := tx.Exec(index).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"log"
+	"sort"
+	"time"
+)
+
+// ErrPending 存在未执行的迁移
+var ErrPending = errors.New("存在未执行的数据库迁移 请先执行 migrate up")
+
+// Migration 一次带编号的结构变更 Up 和 Down 都在事务中执行
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// schemaMigration 记录已执行的迁移
+type schemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"size:255"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Status 单个迁移的执行状态
+type Status struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+	Unknown   bool // 数据库中有记录但代码中不存在
+}
+
+// sortedMigrations 按版本号排序并检查是否重复
+func sortedMigrations() ([]Migration, error) {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+	for i := range sorted {
+		if sorted[i].Version <= 0 {
+			return nil, fmt.Errorf("迁移 %s 的版本号无效", sorted[i].Name)
+		}
+		if i > 0 && sorted[i].Version == sorted[i-1].Version {
+			return nil, fmt.Errorf("迁移版本号重复: %d", sorted[i].Version)
+		}
+	}
+	return sorted, nil
+}
+
+// appliedVersions 读取已执行的迁移 不存在记录表时自动创建
+func appliedVersions(db *gorm.DB) (map[int]schemaMigration, error) {
+	if err := db.AutoMigrate(&schemaMigration{}); err != nil {
+		return nil, err
+	}
+	var records []schemaMigration
+	if err := db.Order("version").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int]schemaMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// Pending 返回尚未执行的迁移
+func Pending(db *gorm.DB) ([]Migration, error) {
+	sorted, err := sortedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, m := range sorted {
+		if _, ok := applied[m.Version]; !ok {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// Up 依次执行所有未执行的迁移 返回执行的数量
+func Up(db *gorm.DB) (int, error) {
+	pending, err := Pending(db)
+	if err != nil {
+		return 0, err
+	}
+	for i, m := range pending {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return i, fmt.Errorf("执行迁移 %04d_%s 失败: %w", m.Version, m.Name, err)
+		}
+		log.Printf("已执行迁移 %04d_%s", m.Version, m.Name)
+	}
+	return len(pending), nil
+}
+
+// Down 按版本号倒序回滚最近执行的 steps 个迁移 返回回滚的数量
+func Down(db *gorm.DB, steps int) (int, error) {
+	sorted, err := sortedMigrations()
+	if err != nil {
+		return 0, err
+	}
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return 0, err
+	}
+
+	rolledBack := 0
+	for i := len(sorted) - 1; i >= 0 && rolledBack < steps; i-- {
+		m := sorted[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == nil {
+			return rolledBack, fmt.Errorf("迁移 %04d_%s 不支持回滚", m.Version, m.Name)
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&schemaMigration{}, "version = ?", m.Version).Error
+		})
+		if err != nil {
+			return rolledBack, fmt.Errorf("回滚迁移 %04d_%s 失败: %w", m.Version, m.Name, err)
+		}
+		log.Printf("已回滚迁移 %04d_%s", m.Version, m.Name)
+		rolledBack++
+	}
+	return rolledBack, nil
+}
+
+// List 返回所有迁移的执行状态
+func List(db *gorm.DB) ([]Status, error) {
+	sorted, err := sortedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []Status
+	known := make(map[int]bool, len(sorted))
+	for _, m := range sorted {
+		known[m.Version] = true
+		status := Status{Version: m.Version, Name: m.Name}
+		if record, ok := applied[m.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = &record.AppliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	for version, record := range applied {
+		if known[version] {
+			continue
+		}
+		appliedAt := record.AppliedAt
+		statuses = append(statuses, Status{Version: version, Name: record.Name, Applied: true, AppliedAt: &appliedAt, Unknown: true})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses, nil
+}
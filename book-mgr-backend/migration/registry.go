@@ -0,0 +1,20 @@
+package migration
+
+// migrations 所有迁移 新增迁移时在末尾追加 已发布的迁移不要修改
+var migrations = []Migration{
+	m0001Baseline,
+	m0002HistoryDueAt,
+	m0003HistoryRenewCount,
+	m0004Hold,
+	m0005FineLedger,
+	m0006BookCategory,
+	m0007Copy,
+	m0008HistoryBorrowIdUnique,
+	m0009IdempotencyKey,
+	m0010HistoryReturnedAt,
+	m0011DeskCirculation,
+	m0012HistoryOutcome,
+	m0013BookTerm,
+	m0014BookPinyin,
+	m0015BookCategoryNotNull,
+}
@@ -7,19 +7,24 @@ import (
 
 type Book struct {
 	gorm.Model
-	Id        int64          `json:"id" gorm:"primaryKey;AUTO_INCREMENT"`
-	Name      string         `json:"name"`
-	Publisher string         `json:"publisher"`
-	Year      int32          `json:"year"`
-	Remark    string         `json:"remark" gorm:"type:TEXT"`
-	Author    string         `json:"author"`
-	ISBN      string         `json:"isbn"`
-	Price     float64        `json:"price"`
-	Residue   int64          `json:"residue"`
-	CoverUrl  string         `json:"cover_url" gorm:"type:TEXT"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `json:"deleted_at"`
+	Id             int64          `json:"id" gorm:"primaryKey;AUTO_INCREMENT"`
+	Name           string         `json:"name"`
+	Publisher      string         `json:"publisher"`
+	Year           int32          `json:"year"`
+	Remark         string         `json:"remark" gorm:"type:TEXT"`
+	Author         string         `json:"author"`
+	Category       string         `json:"category" gorm:"size:64;not null;default:'';index"` // 分类
+	ISBN           string         `json:"isbn"`
+	Price          float64        `json:"price"`
+	Residue        int64          `json:"residue"` // 在架可借的册数 随单册状态变化维护
+	CoverUrl       string         `json:"cover_url" gorm:"type:TEXT"`
+	NamePinyin     string         `json:"-" gorm:"size:255"` // 书名拼音全拼 新增和修改图书时计算
+	NameInitials   string         `json:"-" gorm:"size:255"` // 书名拼音首字母
+	AuthorPinyin   string         `json:"-" gorm:"size:255"` // 作者拼音全拼
+	AuthorInitials string         `json:"-" gorm:"size:255"` // 作者拼音首字母
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `json:"deleted_at"`
 }
 
 func (Book) TableName() string {
@@ -0,0 +1,15 @@
+package model
+
+// BookTerm 书目全文索引 每本书每个字段的每个词项一行
+// Weight 为字段权重乘以词项在该字段中出现的次数
+type BookTerm struct {
+	Id     int64  `json:"id" gorm:"primaryKey;AUTO_INCREMENT"`
+	BookId int64  `json:"book_id" gorm:"index"`
+	Field  string `json:"field" gorm:"size:16"`
+	Term   string `json:"term" gorm:"size:64;index"`
+	Weight int64  `json:"weight"`
+}
+
+func (BookTerm) TableName() string {
+	return "t_book_term"
+}
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// 单册状态
+const (
+	CopyAvailable  = "available"  // 在架可借
+	CopyOnLoan     = "on_loan"    // 已借出
+	CopyOnHold     = "on_hold"    // 已为预约读者保留 等待取书
+	CopyLost       = "lost"       // 遗失
+	CopyRepair     = "repair"     // 修补中
+	CopyWithdrawn  = "withdrawn"  // 已剔旧下架
+	CopyProcessing = "processing" // 入藏中 同一事务内即分配给排队的读者或上架
+)
+
+// Copy 一本实体书 每册有独立的条码和状态
+type Copy struct {
+	Id         int64          `json:"id" gorm:"primaryKey;AUTO_INCREMENT"`
+	BookId     int64          `json:"book_id" gorm:"index"`
+	Barcode    string         `json:"barcode" gorm:"size:64;uniqueIndex"`
+	Status     string         `json:"status" gorm:"size:16;index"`
+	AcquiredAt *time.Time     `json:"acquired_at"` // 入藏日期
+	Remark     string         `json:"remark"`
+	Book       Book           `json:"-" gorm:"foreignKey:BookId"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `json:"deleted_at"`
+}
+
+func (Copy) TableName() string {
+	return "t_copy"
+}
+
+// IsCirculating 是否在借出或保留流程中 这两种状态只能由借还和预约改变
+func (c *Copy) IsCirculating() bool {
+	return c.Status == CopyOnLoan || c.Status == CopyOnHold
+}
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"slices"
+	"time"
+)
+
+// 罚款流水类型 charge 类增加欠款 其余减少欠款
+const (
+	FineOverdue = "overdue" // 超期罚款
+	FineLost    = "lost"    // 丢失赔偿
+	FineDamaged = "damaged" // 损坏赔偿
+	FinePayment = "payment" // 缴费
+	FineWaiver  = "waiver"  // 减免
+)
+
+// FineCharges 增加欠款的流水类型
+var FineCharges = []string{FineOverdue, FineLost, FineDamaged}
+
+// FineEntry 罚款流水 金额单位为分 始终为正数 方向由类型决定
+type FineEntry struct {
+	Id         int64     `json:"id" gorm:"primaryKey;AUTO_INCREMENT"`
+	UserId     int64     `json:"user_id" gorm:"index"`
+	HistoryId  *int64    `json:"history_id" gorm:"index"` // 关联的借阅记录 缴费时可以为空
+	Kind       string    `json:"kind" gorm:"size:16"`
+	Amount     int64     `json:"amount"`
+	OperatorId int64     `json:"operator_id"` // 经办的管理员 系统自动计费时为0
+	Remark     string    `json:"remark"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (FineEntry) TableName() string {
+	return "t_fine_ledger"
+}
+
+// IsCharge 是否为增加欠款的流水
+func (f *FineEntry) IsCharge() bool {
+	return slices.Contains(FineCharges, f.Kind)
+}
+
+// Signed 带方向的金额 欠款为正 缴费和减免为负
+func (f *FineEntry) Signed() int64 {
+	if f.IsCharge() {
+		return f.Amount
+	}
+	return -f.Amount
+}
@@ -2,23 +2,59 @@ package model
 
 import (
 	"gorm.io/gorm"
+	"math"
 	"time"
 )
 
+// 借阅的结束方式
+const (
+	LoanReturned = "returned" // 正常归还
+	LoanLost     = "lost"     // 读者遗失
+	LoanDamaged  = "damaged"  // 归还时已损坏
+)
+
 type History struct {
 	gorm.Model
-	Id         int64          `json:"id" gorm:"primary_key;AUTO_INCREMENT"`
-	BorrowId   string         `json:"borrow_id"`
-	UserId     int64          `json:"user_id"`
-	BookId     int64          `json:"book_id"`
-	BorrowedAt *time.Time     `json:"borrowed_at"`
-	IsBack     bool           `json:"is_back"`           // 是否归还
-	Book       Book           `gorm:"foreignKey:BookId"` // 添加 Book 字段，并标注外键
-	CreatedAt  time.Time      `json:"created_at"`
-	UpdatedAt  time.Time      `json:"updated_at"`
-	DeletedAt  gorm.DeletedAt `json:"deleted_at"`
+	Id               int64          `json:"id" gorm:"primary_key;AUTO_INCREMENT"`
+	BorrowId         string         `json:"borrow_id" gorm:"size:64;uniqueIndex"`
+	UserId           int64          `json:"user_id"`
+	BookId           int64          `json:"book_id"`
+	CopyId           int64          `json:"copy_id" gorm:"index"` // 借出的单册
+	BorrowedAt       *time.Time     `json:"borrowed_at"`
+	DueAt            *time.Time     `json:"due_at" gorm:"index"`    // 应还日期
+	RenewCount       int            `json:"renew_count"`            // 续借次数
+	IsBack           bool           `json:"is_back"`                // 是否归还
+	ReturnedAt       *time.Time     `json:"returned_at"`            // 归还时间
+	Outcome          string         `json:"outcome" gorm:"size:16"` // 结束方式 未归还时为空
+	OperatorId       int64          `json:"operator_id"`            // 在服务台办理借出的馆员 读者自助借阅时为0
+	ReturnOperatorId int64          `json:"return_operator_id"`     // 在服务台办理归还的馆员 读者自助归还时为0
+	Book             Book           `gorm:"foreignKey:BookId"`      // 添加 Book 字段，并标注外键
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `json:"deleted_at"`
 }
 
 func (History) TableName() string {
 	return "t_history"
 }
+
+// IsOverdue 未归还且已超过应还日期
+func (h *History) IsOverdue(now time.Time) bool {
+	return !h.IsBack && h.DueAt != nil && now.After(*h.DueAt)
+}
+
+// DaysOverdue 超期天数 不足一天按一天计算 未超期时为0
+func (h *History) DaysOverdue(now time.Time) int64 {
+	if !h.IsOverdue(now) {
+		return 0
+	}
+	return DaysBetween(*h.DueAt, now)
+}
+
+// DaysBetween 两个时间之间的天数 不足一天按一天计算
+func DaysBetween(from, to time.Time) int64 {
+	if !to.After(from) {
+		return 0
+	}
+	return int64(math.Ceil(to.Sub(from).Hours() / 24))
+}
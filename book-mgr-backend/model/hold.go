@@ -0,0 +1,38 @@
+package model
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// 预约状态
+const (
+	HoldWaiting   = "waiting"   // 排队中
+	HoldReady     = "ready"     // 已为读者保留一本 等待取书
+	HoldFulfilled = "fulfilled" // 已取书借出
+	HoldCancelled = "cancelled" // 已取消
+	HoldExpired   = "expired"   // 超过取书期限
+)
+
+type Hold struct {
+	Id        int64          `json:"id" gorm:"primaryKey;AUTO_INCREMENT"`
+	UserId    int64          `json:"user_id" gorm:"index"`
+	BookId    int64          `json:"book_id" gorm:"index"`
+	Status    string         `json:"status" gorm:"size:16;index"`
+	CopyId    int64          `json:"copy_id" gorm:"index"` // 为读者保留的单册
+	ReadyAt   *time.Time     `json:"ready_at"`             // 分配到书的时间
+	ExpiresAt *time.Time     `json:"expires_at"`           // 取书截止时间
+	Book      Book           `json:"-" gorm:"foreignKey:BookId"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"deleted_at"`
+}
+
+func (Hold) TableName() string {
+	return "t_hold"
+}
+
+// IsActive 是否仍在排队或等待取书
+func (h *Hold) IsActive() bool {
+	return h.Status == HoldWaiting || h.Status == HoldReady
+}
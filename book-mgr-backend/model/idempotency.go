@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// 幂等请求的处理状态
+const (
+	IdempotencyPending = "pending" // 首次请求仍在处理
+	IdempotencyDone    = "done"    // 已保存首次响应
+)
+
+// IdempotencyKey 客户端提供的幂等键 同一用户在同一接口上的键唯一
+type IdempotencyKey struct {
+	Id           int64     `json:"id" gorm:"primaryKey;AUTO_INCREMENT"`
+	UserId       int64     `json:"user_id" gorm:"uniqueIndex:idx_idempotency_scope"` // 未登录的请求为0
+	Method       string    `json:"method" gorm:"size:8;uniqueIndex:idx_idempotency_scope"`
+	Path         string    `json:"path" gorm:"size:128;uniqueIndex:idx_idempotency_scope"`
+	Key          string    `json:"key" gorm:"size:128;uniqueIndex:idx_idempotency_scope"`
+	RequestHash  string    `json:"request_hash" gorm:"size:64"` // 请求体的摘要 同一个键不能用于不同的请求
+	Status       string    `json:"status" gorm:"size:16"`
+	ResponseCode int       `json:"response_code"`
+	ResponseBody string    `json:"response_body" gorm:"type:TEXT"`
+	ExpiresAt    time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+func (IdempotencyKey) TableName() string {
+	return "t_idempotency_key"
+}
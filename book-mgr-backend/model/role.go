@@ -0,0 +1,8 @@
+package model
+
+// 用户角色 即 User.Role 字段的取值
+const (
+	RoleAdmin     = "admin"     // 管理员
+	RoleLibrarian = "librarian" // 图书馆员
+	RoleReader    = "user"      // 普通读者 沿用注册时写入的 "user"
+)
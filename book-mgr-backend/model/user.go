@@ -10,6 +10,7 @@ type User struct {
 	Id        int64          `json:"id" gorm:"primary_key;AUTO_INCREMENT"`
 	Role      string         `json:"role"`
 	Email     string         `json:"email"`
+	CardNo    *string        `json:"card_no" gorm:"size:32;uniqueIndex"` // 借书证号
 	Password  string         `json:"password"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
@@ -0,0 +1,60 @@
+package password
+
+import (
+	"crypto/subtle"
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+// 哈希使用的计算强度
+const hashCost = bcrypt.DefaultCost
+
+// MaxLength 密码的最大字节数 bcrypt 只接受不超过72字节的输入
+const MaxLength = 72
+
+var ErrTooLong = errors.New("密码不能超过72字节")
+
+// Validate 检查密码能否被哈希 注册和修改密码时在哈希前调用
+func Validate(plain string) error {
+	if len(plain) > MaxLength {
+		return ErrTooLong
+	}
+	return nil
+}
+
+// Hash 使用 bcrypt 计算密码的哈希值
+func Hash(plain string) (string, error) {
+	if err := Validate(plain); err != nil {
+		return "", err
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(plain), hashCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+// IsHashed 判断存储的密码是否已经是 bcrypt 哈希 否则视为历史遗留的明文
+func IsHashed(stored string) bool {
+	if len(stored) != 60 {
+		return false
+	}
+	return strings.HasPrefix(stored, "$2a$") || strings.HasPrefix(stored, "$2b$") || strings.HasPrefix(stored, "$2y$")
+}
+
+// Verify 校验密码 当存储的是明文且校验通过时 needsUpgrade 为 true 调用方应重新哈希后保存
+func Verify(stored, plain string) (ok bool, needsUpgrade bool) {
+	if IsHashed(stored) {
+		if bcrypt.CompareHashAndPassword([]byte(stored), []byte(plain)) != nil {
+			return false, false
+		}
+		// 哈希强度低于当前配置时同样需要升级
+		cost, err := bcrypt.Cost([]byte(stored))
+		return true, err == nil && cost < hashCost
+	}
+	if subtle.ConstantTimeCompare([]byte(stored), []byte(plain)) != 1 {
+		return false, false
+	}
+	return true, true
+}
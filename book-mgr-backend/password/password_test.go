@@ -0,0 +1,67 @@
+package password
+
+import (
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+func TestHashAndVerify(t *testing.T) {
+	hashed, err := Hash("pw123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsHashed(hashed) {
+		t.Fatalf("IsHashed(%q) = false", hashed)
+	}
+	if ok, upgrade := Verify(hashed, "pw123456"); !ok || upgrade {
+		t.Errorf("Verify(正确密码) = %v, %v 期望 true, false", ok, upgrade)
+	}
+	if ok, _ := Verify(hashed, "wrong"); ok {
+		t.Error("Verify(错误密码) = true")
+	}
+}
+
+func TestVerifyUpgradesPlaintext(t *testing.T) {
+	if ok, upgrade := Verify("pw123456", "pw123456"); !ok || !upgrade {
+		t.Errorf("Verify(明文) = %v, %v 期望 true, true", ok, upgrade)
+	}
+	if ok, upgrade := Verify("pw123456", "pw12345"); ok || upgrade {
+		t.Errorf("Verify(明文 错误密码) = %v, %v 期望 false, false", ok, upgrade)
+	}
+}
+
+func TestVerifyUpgradesWeakHash(t *testing.T) {
+	weak, err := bcryptHash("pw123456", hashCost-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, upgrade := Verify(weak, "pw123456"); !ok || !upgrade {
+		t.Errorf("Verify(低强度哈希) = %v, %v 期望 true, true", ok, upgrade)
+	}
+}
+
+func TestIsHashed(t *testing.T) {
+	for _, stored := range []string{"", "pw123456", "$2a$" + strings.Repeat("x", 10), "$3a$" + strings.Repeat("x", 56)} {
+		if IsHashed(stored) {
+			t.Errorf("IsHashed(%q) = true", stored)
+		}
+	}
+}
+
+func TestTooLong(t *testing.T) {
+	if err := Validate(strings.Repeat("a", MaxLength)); err != nil {
+		t.Errorf("Validate(72字节) = %v", err)
+	}
+	if err := Validate(strings.Repeat("a", MaxLength+1)); err != ErrTooLong {
+		t.Errorf("Validate(73字节) = %v 期望 ErrTooLong", err)
+	}
+	if _, err := Hash(strings.Repeat("密", 25)); err != ErrTooLong {
+		t.Errorf("Hash(75字节) = %v 期望 ErrTooLong", err)
+	}
+}
+
+func bcryptHash(plain string, cost int) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(plain), cost)
+	return string(hashed), err
+}
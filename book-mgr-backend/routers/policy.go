@@ -0,0 +1,45 @@
+package routers
+
+import "book-mgr-backend/middleware"
+
+// routePolicy 每个接口所需的权限 新增路由必须在此声明 否则服务无法启动
+var routePolicy = middleware.RoutePolicy{
+	"POST /api/admin/v1/login":         middleware.PermPublic,
+	"GET /api/admin/v1/summary":        middleware.PermSummaryRead,
+	"GET /api/admin/v1/book":           middleware.PermBookRead,
+	"GET /api/admin/v1/book/suggest":   middleware.PermBookRead,
+	"POST /api/admin/v1/book":          middleware.PermBookWrite,
+	"PUT /api/admin/v1/book":           middleware.PermBookWrite,
+	"DELETE /api/admin/v1/book":        middleware.PermBookDelete,
+	"GET /api/admin/v1/copy":           middleware.PermBookRead,
+	"POST /api/admin/v1/copy":          middleware.PermBookWrite,
+	"PUT /api/admin/v1/copy":           middleware.PermBookWrite,
+	"GET /api/admin/v1/user":           middleware.PermUserRead,
+	"GET /api/admin/v1/history":        middleware.PermHistoryRead,
+	"GET /api/admin/v1/history/lookup": middleware.PermHistoryRead,
+	"GET /api/admin/v1/overdue":        middleware.PermHistoryRead,
+	"POST /api/admin/v1/checkout":      middleware.PermCirculation,
+	"POST /api/admin/v1/checkin":       middleware.PermCirculation,
+	"POST /api/admin/v1/loan/lost":     middleware.PermCirculation,
+	"POST /api/admin/v1/loan/damaged":  middleware.PermCirculation,
+	"GET /api/admin/v1/hold":           middleware.PermHoldManage,
+	"DELETE /api/admin/v1/hold":        middleware.PermHoldManage,
+	"POST /api/admin/v1/hold/expire":   middleware.PermHoldManage,
+	"GET /api/admin/v1/fine":           middleware.PermFineManage,
+	"POST /api/admin/v1/fine/payment":  middleware.PermFineManage,
+	"POST /api/admin/v1/fine/waive":    middleware.PermFineManage,
+
+	"POST /api/user/v1/login":       middleware.PermPublic,
+	"POST /api/user/v1/register":    middleware.PermPublic,
+	"GET /api/user/v1/summary":      middleware.PermLoanSelf,
+	"GET /api/user/v1/book":         middleware.PermBookRead,
+	"GET /api/user/v1/book/suggest": middleware.PermBookRead,
+	"GET /api/user/v1/history":      middleware.PermLoanSelf,
+	"PATCH /api/user/v1/history":    middleware.PermLoanSelf,
+	"POST /api/user/v1/borrow":      middleware.PermLoanSelf,
+	"POST /api/user/v1/renew":       middleware.PermLoanSelf,
+	"GET /api/user/v1/hold":         middleware.PermLoanSelf,
+	"POST /api/user/v1/hold":        middleware.PermLoanSelf,
+	"DELETE /api/user/v1/hold":      middleware.PermLoanSelf,
+	"GET /api/user/v1/fine":         middleware.PermLoanSelf,
+}
@@ -1,12 +1,13 @@
 package routers
 
 import (
+	"book-mgr-backend/config"
 	"book-mgr-backend/handler/admin"
 	"book-mgr-backend/handler/univer"
 	"book-mgr-backend/handler/user"
+	"book-mgr-backend/middleware"
 	"github.com/gin-gonic/gin"
 	"log"
-	"net/http"
 )
 
 type App struct{}
@@ -14,18 +15,12 @@ type App struct{}
 func (a *App) RunServer() {
 	r := gin.Default()
 
-	r.Use(func(context *gin.Context) {
-		context.Header("Access-Control-Allow-Origin", "*")
-		context.Header("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE, PATCH")
-		context.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		if context.Request.Method == "OPTIONS" {
-			context.AbortWithStatus(http.StatusOK)
-			return
-		}
-		context.Next()
-	})
+	serverConf := config.Conf.Server
 
-	r.GET("books")
+	r.Use(middleware.Cors(serverConf.AllowedOrigins))
+
+	// 按路由声明表鉴权
+	r.Use(middleware.Guard(routePolicy))
 
 	adminGroup := r.Group("/api/admin/v1")
 	{
@@ -34,27 +29,62 @@ func (a *App) RunServer() {
 		adminGroup.GET("summary", admin.GetAdminSummary_Admin)
 
 		adminGroup.GET("book", admin.HandleGetAllBooks_Admin)
-		adminGroup.POST("book", admin.HandleAddBook_Admin)
+		adminGroup.GET("book/suggest", admin.HandleSuggestBooks_Admin)
+		adminGroup.POST("book", middleware.Idempotent(), admin.HandleAddBook_Admin)
 		adminGroup.PUT("book", admin.HandleUpdateBook_Admin)
 		adminGroup.DELETE("book", admin.HandleDeleteBook_Admin)
+		adminGroup.GET("copy", admin.HandleGetCopies_Admin)
+		adminGroup.POST("copy", admin.HandleAddCopies_Admin)
+		adminGroup.PUT("copy", admin.HandleUpdateCopy_Admin)
 
 		adminGroup.GET("user", admin.HandleGetAllUsers_Admin)
 
 		adminGroup.GET("history", admin.GetAllHistories_Admin)
+		adminGroup.GET("history/lookup", admin.HandleLookupLoan_Admin)
+		adminGroup.GET("overdue", admin.HandleGetOverdueLoans_Admin)
+		adminGroup.POST("checkout", middleware.Idempotent(), admin.HandleCheckout_Admin)
+		adminGroup.POST("checkin", middleware.Idempotent(), admin.HandleCheckin_Admin)
+		adminGroup.POST("loan/lost", middleware.Idempotent(), admin.HandleMarkLoanLost_Admin)
+		adminGroup.POST("loan/damaged", middleware.Idempotent(), admin.HandleReturnDamaged_Admin)
+
+		adminGroup.GET("hold", admin.HandleGetHolds_Admin)
+		adminGroup.DELETE("hold", admin.HandleCancelHold_Admin)
+		adminGroup.POST("hold/expire", admin.HandleExpireHolds_Admin)
+
+		adminGroup.GET("fine", admin.HandleGetFines_Admin)
+		adminGroup.POST("fine/payment", admin.HandleRecordFinePayment_Admin)
+		adminGroup.POST("fine/waive", admin.HandleWaiveFine_Admin)
 	}
 
 	userGroup := r.Group("/api/user/v1")
 	{
 		userGroup.POST("login", univer.HandleUserLogin)
-		userGroup.POST("register", univer.HandleUserRegister)
+		userGroup.POST("register", middleware.Idempotent(), univer.HandleUserRegister)
 		userGroup.GET("summary", user.HandleGetSummary_User)
 		userGroup.GET("book", user.HandleGetAllBooks_User)
+		userGroup.GET("book/suggest", user.HandleSuggestBooks_User)
 		userGroup.GET("history", user.HandleGetAllMyBorrowed_User)
-		userGroup.PATCH("history", user.HandleReturnBookById_User)
-		userGroup.POST("borrow", user.HandleBorrowBookById_User)
+		userGroup.PATCH("history", middleware.Idempotent(), user.HandleReturnBookById_User)
+		userGroup.POST("borrow", middleware.Idempotent(), user.HandleBorrowBookById_User)
+		userGroup.POST("renew", user.HandleRenewBookById_User)
+		userGroup.GET("hold", user.HandleGetMyHolds_User)
+		userGroup.POST("hold", user.HandlePlaceHold_User)
+		userGroup.DELETE("hold", user.HandleCancelHold_User)
+		userGroup.GET("fine", user.HandleGetMyFines_User)
 	}
 
-	if err := r.Run("localhost:7001"); err != nil {
+	// 检查所有路由都已声明权限
+	if err := routePolicy.Verify(r.Routes()); err != nil {
+		log.Panicln(err.Error())
+	}
+
+	var err error
+	if serverConf.TLSCertFile != "" {
+		err = r.RunTLS(serverConf.Listen, serverConf.TLSCertFile, serverConf.TLSKeyFile)
+	} else {
+		err = r.Run(serverConf.Listen)
+	}
+	if err != nil {
 		log.Panicln("端口可能已被占用 服务器启动失败" + err.Error())
 	}
 }
@@ -0,0 +1,62 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Similarity 两段文本的相似度 取值0到1 为1减去编辑距离与较长文本长度之比
+// 比较前转为小写并去掉空白和标点
+func Similarity(a, b string) float64 {
+	ra, rb := normalize(a), normalize(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 0
+	}
+	return 1 - float64(editDistance(ra, rb))/float64(longest)
+}
+
+// BestSimilarity 查询与文本整体及文本中每个词的最高相似度 用于匹配作者全名中的姓氏等情况
+func BestSimilarity(q, text string) float64 {
+	best := Similarity(q, text)
+	for _, word := range strings.Fields(text) {
+		if score := Similarity(q, word); score > best {
+			best = score
+		}
+	}
+	return best
+}
+
+func normalize(text string) []rune {
+	var result []rune
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			result = append(result, unicode.ToLower(r))
+		}
+	}
+	return result
+}
+
+// editDistance Levenshtein 编辑距离
+func editDistance(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,70 @@
+package search
+
+import (
+	"github.com/mozillazg/go-pinyin"
+	"strings"
+	"unicode"
+)
+
+// MaxPinyinLength 存储的拼音键最大长度
+const MaxPinyinLength = 255
+
+var pinyinArgs = pinyin.Args{Style: pinyin.Normal}
+
+// Pinyin 计算文本的拼音全拼和首字母 均为小写且不含分隔符
+// 如 "三国演义" 得到 "sanguoyanyi" 和 "sgyy"
+// 字母和数字原样保留 连续的字母数字作为一个词只取一个首字母
+func Pinyin(text string) (full, initials string) {
+	var fullBuilder, initialsBuilder strings.Builder
+	inWord := false
+	for _, r := range text {
+		r = unicode.ToLower(r)
+		if unicode.Is(unicode.Han, r) {
+			inWord = false
+			syllables := pinyin.SinglePinyin(r, pinyinArgs)
+			if len(syllables) == 0 || syllables[0] == "" {
+				continue
+			}
+			fullBuilder.WriteString(syllables[0])
+			initialsBuilder.WriteByte(syllables[0][0])
+			continue
+		}
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			fullBuilder.WriteRune(r)
+			if !inWord {
+				initialsBuilder.WriteRune(r)
+			}
+			inWord = true
+			continue
+		}
+		inWord = false
+	}
+	return truncate(fullBuilder.String()), truncate(initialsBuilder.String())
+}
+
+func truncate(key string) string {
+	if len(key) > MaxPinyinLength {
+		return key[:MaxPinyinLength]
+	}
+	return key
+}
+
+// PinyinQuery 判断查询是否可能是拼音输入 是则返回去掉空格和隔音符后的小写形式
+// 只包含字母 数字 空格和 ' 且至少有一个字母时视为拼音
+func PinyinQuery(q string) (string, bool) {
+	var b strings.Builder
+	hasLetter := false
+	for _, r := range strings.ToLower(q) {
+		switch {
+		case r >= 'a' && r <= 'z':
+			hasLetter = true
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == ' ' || r == '\'':
+		default:
+			return "", false
+		}
+	}
+	return b.String(), hasLetter
+}
@@ -0,0 +1,52 @@
+package search
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPinyin(t *testing.T) {
+	cases := []struct {
+		text, full, initials string
+	}{
+		{"三国演义", "sanguoyanyi", "sgyy"},
+		{"罗贯中", "luoguanzhong", "lgz"},
+		{"Go语言编程", "goyuyanbiancheng", "gyybc"},
+		{"C++ Primer 5版", "cprimer5ban", "cp5b"},
+		{"", "", ""},
+	}
+	for _, c := range cases {
+		full, initials := Pinyin(c.text)
+		if full != c.full || initials != c.initials {
+			t.Errorf("Pinyin(%q) = %q, %q 期望 %q, %q", c.text, full, initials, c.full, c.initials)
+		}
+	}
+}
+
+func TestPinyinTruncates(t *testing.T) {
+	full, initials := Pinyin(strings.Repeat("国", 100))
+	if len(full) != MaxPinyinLength || len(initials) != 100 {
+		t.Errorf("len(full)=%d len(initials)=%d", len(full), len(initials))
+	}
+}
+
+func TestPinyinQuery(t *testing.T) {
+	cases := []struct {
+		q    string
+		key  string
+		isPy bool
+	}{
+		{"SanGuo", "sanguo", true},
+		{"xi'an", "xian", true},
+		{"hong lou meng", "hongloumeng", true},
+		{"2024", "2024", false},
+		{"红楼", "", false},
+		{"c++", "", false},
+	}
+	for _, c := range cases {
+		key, isPy := PinyinQuery(c.q)
+		if key != c.key || isPy != c.isPy {
+			t.Errorf("PinyinQuery(%q) = %q, %v 期望 %q, %v", c.q, key, isPy, c.key, c.isPy)
+		}
+	}
+}
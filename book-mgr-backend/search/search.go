@@ -0,0 +1,162 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+// 分词规则 书目以中文为主 不依赖外部分词词典
+// 中文等表意文字按相邻两字切分 单字另外入索引以支持单字查询
+// 字母和数字按连续片段切分并转为小写
+
+// Terms 索引时的词项 可能重复 由调用方统计次数
+func Terms(text string) []string {
+	var terms []string
+	for _, run := range runs(text) {
+		if !run.ideographic {
+			terms = append(terms, string(run.text))
+			continue
+		}
+		for i := range run.text {
+			terms = append(terms, string(run.text[i]))
+			if i+1 < len(run.text) {
+				terms = append(terms, string(run.text[i:i+2]))
+			}
+		}
+	}
+	return terms
+}
+
+// QueryTerms 查询时的词项 已去重
+// 中文片段只取相邻两字 单独一个字时才用单字 避免单字命中过多
+func QueryTerms(text string) []string {
+	var terms []string
+	seen := map[string]bool{}
+	add := func(term string) {
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+	for _, run := range runs(text) {
+		if !run.ideographic || len(run.text) == 1 {
+			add(string(run.text))
+			continue
+		}
+		for i := 0; i+1 < len(run.text); i++ {
+			add(string(run.text[i : i+2]))
+		}
+	}
+	return terms
+}
+
+type textRun struct {
+	text        []rune
+	ideographic bool
+}
+
+// runs 将文本切成连续的表意文字片段和字母数字片段 其余字符作为分隔
+func runs(text string) []textRun {
+	var result []textRun
+	var current []rune
+	currentIdeo := false
+	flush := func() {
+		if len(current) > 0 {
+			result = append(result, textRun{text: current, ideographic: currentIdeo})
+			current = nil
+		}
+	}
+	for _, r := range text {
+		r = unicode.ToLower(r)
+		switch {
+		case isIdeographic(r):
+			if !currentIdeo {
+				flush()
+			}
+			currentIdeo = true
+			current = append(current, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if currentIdeo {
+				flush()
+			}
+			currentIdeo = false
+			current = append(current, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return result
+}
+
+func isIdeographic(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
+
+// Highlight 用 <em> 标出文本中命中的词项 其余内容做 HTML 转义
+// width 大于0时只截取第一个命中附近 width 个字符 未命中时返回空串
+func Highlight(text string, terms []string, width int) string {
+	source := []rune(text)
+	lower := make([]rune, len(source))
+	for i, r := range source {
+		lower[i] = unicode.ToLower(r)
+	}
+	marked := make([]bool, len(source))
+	first := -1
+	for _, term := range terms {
+		needle := []rune(term)
+		if len(needle) == 0 {
+			continue
+		}
+		for i := 0; i+len(needle) <= len(lower); i++ {
+			if string(lower[i:i+len(needle)]) != term {
+				continue
+			}
+			for j := i; j < i+len(needle); j++ {
+				marked[j] = true
+			}
+			if first < 0 || i < first {
+				first = i
+			}
+		}
+	}
+	if first < 0 {
+		return ""
+	}
+
+	start, end := 0, len(source)
+	if width > 0 && len(source) > width {
+		start = first - width/4
+		if start < 0 {
+			start = 0
+		}
+		end = start + width
+		if end > len(source) {
+			end, start = len(source), len(source)-width
+		}
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for i := start; i < end; {
+		j := i
+		for j < end && marked[j] == marked[i] {
+			j++
+		}
+		segment := html.EscapeString(string(source[i:j]))
+		if marked[i] {
+			b.WriteString("<em>" + segment + "</em>")
+		} else {
+			b.WriteString(segment)
+		}
+		i = j
+	}
+	if end < len(source) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
@@ -0,0 +1,77 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTerms(t *testing.T) {
+	cases := []struct {
+		text string
+		want []string
+	}{
+		{"三国演义", []string{"三", "三国", "国", "国演", "演", "演义", "义"}},
+		{"Go 语言", []string{"go", "语", "语言", "言"}},
+		{"ISBN 978-7-02", []string{"isbn", "978", "7", "02"}},
+		{"红楼梦Vol2", []string{"红", "红楼", "楼", "楼梦", "梦", "vol2"}},
+		{"  ,.  ", nil},
+	}
+	for _, c := range cases {
+		if got := Terms(c.text); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Terms(%q) = %q 期望 %q", c.text, got, c.want)
+		}
+	}
+}
+
+func TestQueryTerms(t *testing.T) {
+	cases := []struct {
+		text string
+		want []string
+	}{
+		{"三国演义", []string{"三国", "国演", "演义"}},
+		{"梦", []string{"梦"}},
+		{"Go Go go", []string{"go"}},
+		{"红楼 红楼", []string{"红楼"}},
+		{"", nil},
+	}
+	for _, c := range cases {
+		if got := QueryTerms(c.text); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("QueryTerms(%q) = %q 期望 %q", c.text, got, c.want)
+		}
+	}
+}
+
+// 查询词项都应出现在同一段文本的索引词项中 否则全文检索查不到原文
+func TestQueryTermsAreIndexed(t *testing.T) {
+	for _, text := range []string{"三国演义", "The Go Programming Language", "罗贯中 著", "梦"} {
+		indexed := map[string]bool{}
+		for _, term := range Terms(text) {
+			indexed[term] = true
+		}
+		for _, term := range QueryTerms(text) {
+			if !indexed[term] {
+				t.Errorf("%q 的查询词项 %q 不在索引中", text, term)
+			}
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	cases := []struct {
+		text  string
+		terms []string
+		width int
+		want  string
+	}{
+		{"三国演义", []string{"三国"}, 0, "<em>三国</em>演义"},
+		{"The Go Book", []string{"go"}, 0, "The <em>Go</em> Book"},
+		{"<b>红楼梦</b>", []string{"红楼"}, 0, "&lt;b&gt;<em>红楼</em>梦&lt;/b&gt;"},
+		{"三国演义", []string{"水浒"}, 0, ""},
+		{"一二三四五六七八九十", []string{"八九"}, 4, "…七<em>八九</em>十"},
+	}
+	for _, c := range cases {
+		if got := Highlight(c.text, c.terms, c.width); got != c.want {
+			t.Errorf("Highlight(%q, %q, %d) = %q 期望 %q", c.text, c.terms, c.width, got, c.want)
+		}
+	}
+}
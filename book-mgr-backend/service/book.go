@@ -0,0 +1,38 @@
+package service
+
+import (
+	"book-mgr-backend/model"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+var ErrBookInCirculation = newError(http.StatusConflict, "该书仍有未归还的借阅或有效的预约 不能删除")
+
+// DeleteBook 删除图书及其单册和检索索引 需在事务中调用
+// 仍有未归还的借阅或有效的预约时返回 ErrBookInCirculation 图书不存在时返回 ErrBookNotFound
+func DeleteBook(tx *gorm.DB, bookId int64) error {
+	var open int64
+	if err := tx.Model(&model.History{}).Where("book_id = ? AND is_back = ?", bookId, false).Count(&open).Error; err != nil {
+		return err
+	}
+	var holds int64
+	if err := tx.Model(&model.Hold{}).Where("book_id = ? AND status IN ?", bookId, []string{model.HoldWaiting, model.HoldReady}).
+		Count(&holds).Error; err != nil {
+		return err
+	}
+	if open > 0 || holds > 0 {
+		return ErrBookInCirculation
+	}
+
+	result := tx.Where("id = ?", bookId).Delete(&model.Book{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrBookNotFound
+	}
+	if err := tx.Where("book_id = ?", bookId).Delete(&model.Copy{}).Error; err != nil {
+		return err
+	}
+	return UnindexBook(tx, bookId)
+}
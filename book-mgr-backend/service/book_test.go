@@ -0,0 +1,62 @@
+package service
+
+import (
+	"book-mgr-backend/model"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDeleteBook(t *testing.T) {
+	db := openTestDB(t)
+	bookId := createBookWithCopies(t, db, 1)
+	users := createReaders(t, db, 1)
+
+	history, err := checkout(db, &users[0], bookId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteBook(db, bookId); !errors.Is(err, ErrBookInCirculation) {
+		t.Fatalf("有未归还的借阅时 err=%v 期望 ErrBookInCirculation", err)
+	}
+	if err := returnLoan(db, history.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteBook(db, bookId); err != nil {
+		t.Fatal(err)
+	}
+	var copies int64
+	if err := db.Model(&model.Copy{}).Where("book_id = ?", bookId).Count(&copies).Error; err != nil {
+		t.Fatal(err)
+	}
+	if copies != 0 {
+		t.Errorf("删除图书后仍有 %d 个单册", copies)
+	}
+	if err := DeleteBook(db, bookId); !errors.Is(err, ErrBookNotFound) {
+		t.Errorf("重复删除 err=%v 期望 ErrBookNotFound", err)
+	}
+}
+
+func TestDeleteBookWithActiveHold(t *testing.T) {
+	db := openTestDB(t)
+	bookId := createBookWithCopies(t, db, 1)
+	users := createReaders(t, db, 2)
+
+	if _, err := checkout(db, &users[0], bookId); err != nil {
+		t.Fatal(err)
+	}
+	hold, err := PlaceHold(db, users[1].Id, bookId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CancelHold(db, hold.Id, 0, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PlaceHold(db, users[1].Id, bookId); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteBook(db, bookId); !errors.Is(err, ErrBookInCirculation) {
+		t.Errorf("有有效的预约时 err=%v 期望 ErrBookInCirculation", err)
+	}
+}
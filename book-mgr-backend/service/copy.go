@@ -0,0 +1,142 @@
+package service
+
+import (
+	"book-mgr-backend/model"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// MaxCopiesPerRequest 一次最多入藏的册数
+const MaxCopiesPerRequest = 500
+
+var (
+	ErrCopyNotFound      = newError(http.StatusNotFound, "单册不存在")
+	ErrCopyStatusChanged = newError(http.StatusConflict, "单册状态已变化 请重试")
+	ErrCopyInCirculation = newError(http.StatusConflict, "单册已借出或正为预约保留 不能直接修改状态")
+	ErrInvalidCopyStatus = newError(http.StatusBadRequest, "无效的单册状态")
+	ErrInvalidCopyCount  = newError(http.StatusBadRequest, fmt.Sprintf("册数需在1到%d之间", MaxCopiesPerRequest))
+	ErrBarcodeDuplicate  = newError(http.StatusConflict, "条码已存在")
+)
+
+// 管理员可以直接设置的单册状态 借出和保留只能经由借还和预约流程
+var manualCopyStatuses = map[string]bool{
+	model.CopyAvailable: true,
+	model.CopyRepair:    true,
+	model.CopyLost:      true,
+	model.CopyWithdrawn: true,
+}
+
+// BookBarcode 按图书id和入藏序号生成条码
+func BookBarcode(bookId int64, seq int64) string {
+	return fmt.Sprintf("%08d%04d", bookId, seq)
+}
+
+// AddCopies 为图书入藏新的单册 未指定条码时按 count 自动生成
+// 新单册与归还的单册一样优先分配给排队的读者 不能让到馆的读者越过预约队列
+func AddCopies(tx *gorm.DB, bookId int64, barcodes []string, count int, acquiredAt, now time.Time) ([]model.Copy, error) {
+	if len(barcodes) > 0 {
+		count = len(barcodes)
+	}
+	if count <= 0 || count > MaxCopiesPerRequest {
+		return nil, ErrInvalidCopyCount
+	}
+
+	var book model.Book
+	if err := tx.Select("id").First(&book, bookId).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBookNotFound
+		}
+		return nil, err
+	}
+
+	if len(barcodes) == 0 {
+		// 序号包含已删除的单册 生成的条码不会与历史条码重复
+		var existing int64
+		if err := tx.Unscoped().Model(&model.Copy{}).Where("book_id = ?", bookId).Count(&existing).Error; err != nil {
+			return nil, err
+		}
+		for i := 1; i <= count; i++ {
+			barcodes = append(barcodes, BookBarcode(bookId, existing+int64(i)))
+		}
+	}
+
+	seen := make(map[string]bool, len(barcodes))
+	for i, barcode := range barcodes {
+		barcode = strings.TrimSpace(barcode)
+		if barcode == "" || seen[barcode] {
+			return nil, ErrBarcodeDuplicate
+		}
+		seen[barcode] = true
+		barcodes[i] = barcode
+	}
+	var duplicated int64
+	if err := tx.Unscoped().Model(&model.Copy{}).Where("barcode IN ?", barcodes).Count(&duplicated).Error; err != nil {
+		return nil, err
+	}
+	if duplicated > 0 {
+		return nil, ErrBarcodeDuplicate
+	}
+
+	copies := make([]model.Copy, 0, len(barcodes))
+	for _, barcode := range barcodes {
+		copies = append(copies, model.Copy{
+			BookId:     bookId,
+			Barcode:    barcode,
+			Status:     model.CopyProcessing,
+			AcquiredAt: &acquiredAt,
+		})
+	}
+	if err := tx.Create(&copies).Error; err != nil {
+		return nil, err
+	}
+	for i := range copies {
+		hold, err := ReleaseCopy(tx, copies[i].Id, now)
+		if err != nil {
+			return nil, err
+		}
+		copies[i].Status = model.CopyAvailable
+		if hold != nil {
+			copies[i].Status = model.CopyOnHold
+		}
+	}
+	return copies, nil
+}
+
+// ChangeCopyStatus 管理员修改在馆单册的状态 改回在架时优先分配给排队的读者
+func ChangeCopyStatus(tx *gorm.DB, copyId int64, status string, now time.Time) (*model.Copy, error) {
+	if !manualCopyStatuses[status] {
+		return nil, ErrInvalidCopyStatus
+	}
+	var item model.Copy
+	if err := tx.First(&item, copyId).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCopyNotFound
+		}
+		return nil, err
+	}
+	if item.IsCirculating() {
+		return nil, ErrCopyInCirculation
+	}
+	if item.Status == status {
+		return &item, nil
+	}
+
+	if status == model.CopyAvailable {
+		if _, err := ReleaseCopy(tx, item.Id, now); err != nil {
+			return nil, err
+		}
+		return &item, tx.First(&item, item.Id).Error
+	}
+	ok, err := setCopyStatus(tx, &item, status)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrCopyStatusChanged
+	}
+	return &item, nil
+}
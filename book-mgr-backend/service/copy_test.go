@@ -0,0 +1,60 @@
+package service
+
+import (
+	"book-mgr-backend/model"
+	"errors"
+	"gorm.io/gorm"
+	"testing"
+	"time"
+)
+
+// 新入藏的单册先分配给排队的读者 剩余的才上架
+func TestAddCopiesServesWaitingHolds(t *testing.T) {
+	db := openTestDB(t)
+	bookId := createBookWithCopies(t, db, 1)
+	users := createReaders(t, db, 3)
+
+	if _, err := checkout(db, &users[0], bookId); err != nil {
+		t.Fatal(err)
+	}
+	var holds []*model.Hold
+	for _, user := range users[1:] {
+		hold, err := PlaceHold(db, user.Id, bookId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		holds = append(holds, hold)
+	}
+
+	var copies []model.Copy
+	if err := db.Transaction(func(tx *gorm.DB) (err error) {
+		now := time.Now()
+		copies, err = AddCopies(tx, bookId, nil, 3, now, now)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	statuses := map[string]int{}
+	for _, item := range copies {
+		statuses[item.Status]++
+	}
+	if statuses[model.CopyOnHold] != 2 || statuses[model.CopyAvailable] != 1 {
+		t.Errorf("新单册状态 %v 期望 2 册保留 1 册在架", statuses)
+	}
+	for _, hold := range holds {
+		if err := db.First(hold, hold.Id).Error; err != nil {
+			t.Fatal(err)
+		}
+		if hold.Status != model.HoldReady || hold.CopyId == 0 {
+			t.Errorf("预约 %d 状态 %s 期望已分配单册", hold.Id, hold.Status)
+		}
+	}
+	if residue := assertStock(t, db, bookId); residue != 1 {
+		t.Errorf("库存为 %d 期望 1", residue)
+	}
+
+	// 有在架的书时不需要预约
+	if _, err := PlaceHold(db, users[0].Id, bookId); !errors.Is(err, ErrHoldUnnecessary) {
+		t.Errorf("err=%v 期望 ErrHoldUnnecessary", err)
+	}
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+)
+
+// 借阅被拒绝时返回给客户端的原因码
+const (
+	ReasonNoCopies       = "NO_COPIES_AVAILABLE"      // 无可借库存
+	ReasonFineBalance    = "FINE_BALANCE_EXCEEDED"    // 欠款超过限额
+	ReasonLoanLimit      = "LOAN_LIMIT_REACHED"       // 达到角色的同时借阅上限
+	ReasonTitleCopyLimit = "TITLE_COPY_LIMIT_REACHED" // 同一本书借阅册数达到上限
+	ReasonCategoryLimit  = "CATEGORY_LIMIT_REACHED"   // 达到分类的同时借阅上限
+)
+
+// Error 可以直接返回给客户端的业务错误 Code 与响应中的 code 字段一致
+type Error struct {
+	Code   int
+	Msg    string
+	Reason string // 机器可读的原因码 可以为空
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+func newError(code int, msg string) *Error {
+	return &Error{Code: code, Msg: msg}
+}
+
+func newReasonError(code int, reason, msg string) *Error {
+	return &Error{Code: code, Msg: msg, Reason: reason}
+}
+
+// Describe 取出业务错误的状态码 提示和原因码 其他错误按服务器错误处理
+func Describe(err error) (code int, msg string, reason string) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code, e.Msg, e.Reason
+	}
+	return http.StatusInternalServerError, "服务器错误，请稍后重试", ""
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"gorm.io/gorm"
+	"net/http"
+)
+
+// 分面的名称 统计某个分面时不应用该分面自身的筛选条件 以便展示其他可选项
+const (
+	FacetPublisher    = "publisher"
+	FacetAuthor       = "author"
+	FacetCategory     = "category"
+	FacetYear         = "year"
+	FacetPrice        = "price"
+	FacetAvailability = "availability"
+)
+
+// MaxFacetBuckets 出版社 作者和分类分面最多返回的取值数
+const MaxFacetBuckets = 20
+
+// priceFacetBounds 价格分面的区间下界 单位为元 最后一个区间没有上界
+var priceFacetBounds = []float64{0, 20, 50, 100}
+
+var ErrInvalidRange = newError(http.StatusBadRequest, "筛选区间的下限不能大于上限")
+
+// BookFilter 书籍列表的筛选条件 各条件之间为与 同一条件的多个取值之间为或
+type BookFilter struct {
+	Publishers []string
+	Authors    []string
+	Categories []string
+	YearMin    *int64   // 含
+	YearMax    *int64   // 含
+	PriceMin   *float64 // 含
+	PriceMax   *float64 // 不含 与价格分面的区间一致
+	Available  *bool    // 是否有在架可借的册
+}
+
+// Validate 检查区间是否有效
+func (f *BookFilter) Validate() error {
+	if f.YearMin != nil && f.YearMax != nil && *f.YearMin > *f.YearMax {
+		return ErrInvalidRange
+	}
+	if f.PriceMin != nil && f.PriceMax != nil && *f.PriceMin > *f.PriceMax {
+		return ErrInvalidRange
+	}
+	return nil
+}
+
+// Apply 添加筛选条件 skip 为统计分面时需要跳过的分面
+func (f *BookFilter) Apply(query *gorm.DB, skip string) *gorm.DB {
+	if len(f.Publishers) > 0 && skip != FacetPublisher {
+		query = query.Where("t_books.publisher IN ?", f.Publishers)
+	}
+	if len(f.Authors) > 0 && skip != FacetAuthor {
+		query = query.Where("t_books.author IN ?", f.Authors)
+	}
+	if len(f.Categories) > 0 && skip != FacetCategory {
+		query = query.Where("t_books.category IN ?", f.Categories)
+	}
+	if skip != FacetYear {
+		if f.YearMin != nil {
+			query = query.Where("t_books.year >= ?", *f.YearMin)
+		}
+		if f.YearMax != nil {
+			query = query.Where("t_books.year <= ?", *f.YearMax)
+		}
+	}
+	if skip != FacetPrice {
+		if f.PriceMin != nil {
+			query = query.Where("t_books.price >= ?", *f.PriceMin)
+		}
+		if f.PriceMax != nil {
+			query = query.Where("t_books.price < ?", *f.PriceMax)
+		}
+	}
+	if f.Available != nil && skip != FacetAvailability {
+		if *f.Available {
+			query = query.Where("t_books.residue > 0")
+		} else {
+			query = query.Where("t_books.residue <= 0")
+		}
+	}
+	return query
+}
+
+// FacetBucket 取值分面的一项
+type FacetBucket struct {
+	Value string `json:"value" gorm:"column:facet_value"`
+	Count int64  `json:"count" gorm:"column:facet_count"`
+}
+
+// RangeBucket 区间分面的一项 Max 为空表示没有上界
+type RangeBucket struct {
+	Min   float64  `json:"min"`
+	Max   *float64 `json:"max"`
+	Count int64    `json:"count"`
+}
+
+// BookFacets 书籍列表的分面统计
+type BookFacets struct {
+	Publisher   []FacetBucket `json:"publisher"`
+	Author      []FacetBucket `json:"author"`
+	Category    []FacetBucket `json:"category"`
+	Year        []RangeBucket `json:"year"`  // 按年代 上下界均含
+	Price       []RangeBucket `json:"price"` // 含下界不含上界
+	Available   int64         `json:"available"`
+	Unavailable int64         `json:"unavailable"`
+}
+
+// CountBookFacets 统计分面 scope 返回应用了检索和除 skip 外全部筛选条件的查询
+func CountBookFacets(scope func(skip string) (*gorm.DB, error)) (*BookFacets, error) {
+	facets := &BookFacets{}
+	scoped := map[string]*gorm.DB{}
+	for _, name := range []string{FacetPublisher, FacetAuthor, FacetCategory, FacetYear, FacetPrice, FacetAvailability} {
+		query, err := scope(name)
+		if err != nil {
+			return nil, err
+		}
+		scoped[name] = query.Session(&gorm.Session{})
+	}
+
+	for _, facet := range []struct {
+		name    string
+		buckets *[]FacetBucket
+	}{
+		{FacetPublisher, &facets.Publisher},
+		{FacetAuthor, &facets.Author},
+		{FacetCategory, &facets.Category},
+	} {
+		column := "t_books." + facet.name
+		*facet.buckets = []FacetBucket{}
+		if err := scoped[facet.name].
+			Select(column + " AS facet_value, COUNT(*) AS facet_count").
+			Where(column + " <> ''").
+			Group(column).
+			Order("facet_count DESC, facet_value").
+			Limit(MaxFacetBuckets).
+			Scan(facet.buckets).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	var decades []struct {
+		Decade int64
+		Total  int64
+	}
+	if err := scoped[FacetYear].
+		Select("t_books.year - (t_books.year % 10) AS decade, COUNT(*) AS total").
+		Where("t_books.year > 0").
+		Group("t_books.year - (t_books.year % 10)").
+		Order("decade DESC").
+		Scan(&decades).Error; err != nil {
+		return nil, err
+	}
+	facets.Year = make([]RangeBucket, 0, len(decades))
+	for _, decade := range decades {
+		max := float64(decade.Decade + 9)
+		facets.Year = append(facets.Year, RangeBucket{Min: float64(decade.Decade), Max: &max, Count: decade.Total})
+	}
+
+	facets.Price = make([]RangeBucket, len(priceFacetBounds))
+	for i, min := range priceFacetBounds {
+		bucket := RangeBucket{Min: min}
+		query := scoped[FacetPrice].Where("t_books.price >= ?", min)
+		if i+1 < len(priceFacetBounds) {
+			max := priceFacetBounds[i+1]
+			bucket.Max = &max
+			query = query.Where("t_books.price < ?", max)
+		}
+		if err := query.Count(&bucket.Count).Error; err != nil {
+			return nil, err
+		}
+		facets.Price[i] = bucket
+	}
+
+	if err := scoped[FacetAvailability].Where("t_books.residue > 0").Count(&facets.Available).Error; err != nil {
+		return nil, err
+	}
+	if err := scoped[FacetAvailability].Where("t_books.residue <= 0").Count(&facets.Unavailable).Error; err != nil {
+		return nil, err
+	}
+	return facets, nil
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"book-mgr-backend/config"
+	"book-mgr-backend/model"
+	"errors"
+	"gorm.io/gorm"
+	"math"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrInvalidAmount   = newError(http.StatusBadRequest, "金额无效")
+	ErrAmountTooLarge  = newError(http.StatusUnprocessableEntity, "金额超过当前欠款")
+	ErrLoanOtherPatron = newError(http.StatusBadRequest, "借阅记录不属于该读者")
+	ErrBalanceTooLarge = newReasonError(http.StatusUnprocessableEntity, ReasonFineBalance, "欠款超过限额 请先缴清罚款")
+)
+
+// YuanToCents 元转换为分
+func YuanToCents(yuan float64) int64 {
+	return int64(math.Round(yuan * 100))
+}
+
+// OverdueFine 按超期天数计算罚款 不超过单次借阅的上限
+func OverdueFine(daysOverdue int64) int64 {
+	fines := config.Conf.Fines
+	amount := daysOverdue * fines.OverdueDailyCents
+	if fines.OverdueCapCents > 0 && amount > fines.OverdueCapCents {
+		amount = fines.OverdueCapCents
+	}
+	return amount
+}
+
+// LostCharge 丢失赔偿 按书价加上手续费计算
+func LostCharge(book *model.Book) int64 {
+	return YuanToCents(book.Price) + config.Conf.Fines.LostProcessingCents
+}
+
+// DamageCharge 损坏赔偿 默认按书价计算
+func DamageCharge(book *model.Book) int64 {
+	return YuanToCents(book.Price)
+}
+
+// Balance 用户当前欠款 单位为分 由数据库汇总流水 不加载全部记录
+func Balance(tx *gorm.DB, userId int64) (int64, error) {
+	var balance int64
+	err := tx.Model(&model.FineEntry{}).
+		Select("COALESCE(SUM(CASE WHEN kind IN ? THEN amount ELSE -amount END), 0)", model.FineCharges).
+		Where("user_id = ?", userId).
+		Scan(&balance).Error
+	return balance, err
+}
+
+// CheckBalanceAllowsBorrow 欠款超过限额时不允许借阅
+func CheckBalanceAllowsBorrow(tx *gorm.DB, userId int64) error {
+	threshold := config.Conf.Fines.BlockThresholdCents
+	if threshold <= 0 {
+		return nil
+	}
+	balance, err := Balance(tx, userId)
+	if err != nil {
+		return err
+	}
+	if balance > threshold {
+		return ErrBalanceTooLarge
+	}
+	return nil
+}
+
+// AssessOverdueFine 归还时按超期天数记一笔罚款 未超期时不记账
+func AssessOverdueFine(tx *gorm.DB, history *model.History, returnedAt time.Time) (*model.FineEntry, error) {
+	if history.DueAt == nil || !returnedAt.After(*history.DueAt) {
+		return nil, nil
+	}
+	amount := OverdueFine(model.DaysBetween(*history.DueAt, returnedAt))
+	if amount <= 0 {
+		return nil, nil
+	}
+	entry := model.FineEntry{
+		UserId:    history.UserId,
+		HistoryId: &history.Id,
+		Kind:      model.FineOverdue,
+		Amount:    amount,
+		Remark:    "借阅 " + history.BorrowId + " 超期",
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// ChargeReplacement 为丢失或损坏的图书记一笔赔偿 金额为0时不记账
+func ChargeReplacement(tx *gorm.DB, history *model.History, book *model.Book, kind string, amount, operatorId int64) (*model.FineEntry, error) {
+	if amount <= 0 {
+		return nil, nil
+	}
+	action := "丢失"
+	if kind == model.FineDamaged {
+		action = "损坏"
+	}
+	entry := model.FineEntry{
+		UserId:     history.UserId,
+		HistoryId:  &history.Id,
+		Kind:       kind,
+		Amount:     amount,
+		OperatorId: operatorId,
+		Remark:     "借阅 " + history.BorrowId + " " + action + " 《" + book.Name + "》",
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// RecordCredit 记录缴费或减免 金额不能超过当前欠款
+func RecordCredit(tx *gorm.DB, kind string, userId, historyId, amount, operatorId int64, remark string) (*model.FineEntry, error) {
+	if amount <= 0 || (kind != model.FinePayment && kind != model.FineWaiver) {
+		return nil, ErrInvalidAmount
+	}
+	// 锁定读者 同一读者的并发缴费依次校验欠款 不会冲减到负数
+	if err := LockUser(tx, userId); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPatronNotFound
+		}
+		return nil, err
+	}
+	// 关联的借阅必须是该读者的 防止把缴费记到他人的借阅上
+	if historyId > 0 {
+		var history model.History
+		if err := tx.Select("id", "user_id").First(&history, historyId).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrLoanNotFound
+			}
+			return nil, err
+		}
+		if history.UserId != userId {
+			return nil, ErrLoanOtherPatron
+		}
+	}
+	balance, err := Balance(tx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if amount > balance {
+		return nil, ErrAmountTooLarge
+	}
+
+	entry := model.FineEntry{
+		UserId:     userId,
+		Kind:       kind,
+		Amount:     amount,
+		OperatorId: operatorId,
+		Remark:     remark,
+	}
+	if historyId > 0 {
+		entry.HistoryId = &historyId
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// AccruingFines 未归还的超期借阅到目前为止应计的罚款 尚未记账
+func AccruingFines(tx *gorm.DB, userId int64, now time.Time) (int64, error) {
+	var histories []model.History
+	if err := tx.Where("user_id = ? AND is_back = ? AND due_at < ?", userId, false, now).Find(&histories).Error; err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, history := range histories {
+		total += OverdueFine(history.DaysOverdue(now))
+	}
+	return total, nil
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"book-mgr-backend/model"
+	"errors"
+	"gorm.io/gorm"
+	"sync"
+	"testing"
+)
+
+func TestBalance(t *testing.T) {
+	db := openTestDB(t)
+	users := createReaders(t, db, 2)
+	entries := []model.FineEntry{
+		{UserId: users[0].Id, Kind: model.FineOverdue, Amount: 300},
+		{UserId: users[0].Id, Kind: model.FineLost, Amount: 2500},
+		{UserId: users[0].Id, Kind: model.FinePayment, Amount: 1000},
+		{UserId: users[0].Id, Kind: model.FineWaiver, Amount: 800},
+		{UserId: users[1].Id, Kind: model.FineDamaged, Amount: 100},
+	}
+	if err := db.Create(&entries).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		userId int64
+		want   int64
+	}{{users[0].Id, 1000}, {users[1].Id, 100}, {0, 0}} {
+		if balance, err := Balance(db, c.userId); err != nil || balance != c.want {
+			t.Errorf("Balance(%d) = %d, %v 期望 %d", c.userId, balance, err, c.want)
+		}
+	}
+}
+
+// 同一读者的并发缴费不能使欠款变为负数
+func TestConcurrentCreditsNeverOverpay(t *testing.T) {
+	db := openTestDB(t)
+	users := createReaders(t, db, 1)
+	userId := users[0].Id
+	if err := db.Create(&model.FineEntry{UserId: userId, Kind: model.FineOverdue, Amount: 500}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := db.Transaction(func(tx *gorm.DB) error {
+				_, err := RecordCredit(tx, model.FinePayment, userId, 0, 200, 0, "")
+				return err
+			})
+			if err != nil {
+				if !errors.Is(err, ErrAmountTooLarge) {
+					t.Errorf("缴费失败: %v", err)
+				}
+				return
+			}
+			mu.Lock()
+			succeeded++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if succeeded != 2 {
+		t.Errorf("成功缴费 %d 次 期望 2 次", succeeded)
+	}
+	if balance, err := Balance(db, userId); err != nil || balance != 100 {
+		t.Errorf("缴费后欠款 %d, %v 期望 100", balance, err)
+	}
+}
+
+func TestRecordCreditUnknownPatron(t *testing.T) {
+	db := openTestDB(t)
+	if _, err := RecordCredit(db, model.FinePayment, 999, 0, 100, 0, ""); !errors.Is(err, ErrPatronNotFound) {
+		t.Errorf("err=%v 期望 ErrPatronNotFound", err)
+	}
+}
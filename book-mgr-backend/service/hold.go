@@ -0,0 +1,257 @@
+package service
+
+import (
+	"book-mgr-backend/config"
+	"book-mgr-backend/model"
+	"errors"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrHoldNotFound    = newError(http.StatusNotFound, "预约不存在")
+	ErrHoldNotActive   = newError(http.StatusConflict, "预约已结束")
+	ErrHoldDuplicate   = newError(http.StatusConflict, "已预约该书")
+	ErrHoldUnnecessary = newError(http.StatusConflict, "该书仍有库存 可直接借阅")
+	ErrHoldOnLoan      = newError(http.StatusConflict, "正在借阅该书 无需预约")
+	ErrBookNotFound    = newError(http.StatusNotFound, "图书不存在")
+)
+
+// PlaceHold 为库存为0的图书排队预约 需在事务中调用
+func PlaceHold(tx *gorm.DB, userId, bookId int64) (*model.Hold, error) {
+	// 锁定读者 同一读者的并发预约依次检查 不会重复排队
+	if err := LockUser(tx, userId); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPatronNotFound
+		}
+		return nil, err
+	}
+
+	var book model.Book
+	if err := tx.First(&book, bookId).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBookNotFound
+		}
+		return nil, err
+	}
+	if book.Residue > 0 {
+		return nil, ErrHoldUnnecessary
+	}
+
+	var count int64
+	if err := tx.Model(&model.Hold{}).
+		Where("user_id = ? AND book_id = ? AND status IN ?", userId, bookId, []string{model.HoldWaiting, model.HoldReady}).
+		Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrHoldDuplicate
+	}
+	if err := tx.Model(&model.History{}).
+		Where("user_id = ? AND book_id = ? AND is_back = ?", userId, bookId, false).
+		Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrHoldOnLoan
+	}
+
+	hold := model.Hold{UserId: userId, BookId: bookId, Status: model.HoldWaiting}
+	if err := tx.Create(&hold).Error; err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+// HoldPosition 排队中的预约在队列中的位置 从1开始
+func HoldPosition(tx *gorm.DB, hold *model.Hold) (int64, error) {
+	if hold.Status != model.HoldWaiting {
+		return 0, nil
+	}
+	var ahead int64
+	err := tx.Model(&model.Hold{}).
+		Where("book_id = ? AND status = ? AND id < ?", hold.BookId, model.HoldWaiting, hold.Id).
+		Count(&ahead).Error
+	return ahead + 1, err
+}
+
+// HasWaitingHold 除指定用户外是否还有读者在排队
+func HasWaitingHold(tx *gorm.DB, bookId, exceptUserId int64) (bool, error) {
+	var count int64
+	err := tx.Model(&model.Hold{}).
+		Where("book_id = ? AND status = ? AND user_id <> ?", bookId, model.HoldWaiting, exceptUserId).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// FulfillReadyHold 读者取走为其保留的单册 没有可取的预约时返回 nil
+// 保留的单册不计入库存 因此取书时不需要扣减库存
+func FulfillReadyHold(tx *gorm.DB, userId, bookId int64, now time.Time) (*model.Copy, error) {
+	var hold model.Hold
+	err := tx.Where("user_id = ? AND book_id = ? AND status = ? AND expires_at >= ?", userId, bookId, model.HoldReady, now).
+		First(&hold).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := tx.Model(&model.Hold{}).
+		Where("id = ? AND status = ?", hold.Id, model.HoldReady).
+		Update("status", model.HoldFulfilled)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, result.Error
+	}
+
+	var item model.Copy
+	if err := tx.First(&item, hold.CopyId).Error; err != nil {
+		return nil, err
+	}
+	ok, err := setCopyStatus(tx, &item, model.CopyOnLoan)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrCopyStatusChanged
+	}
+	return &item, nil
+}
+
+// ReleaseCopy 一册书回到馆内 优先为队列中的下一位读者保留 没有人排队时放回书架
+func ReleaseCopy(tx *gorm.DB, copyId int64, now time.Time) (*model.Hold, error) {
+	var item model.Copy
+	if err := tx.First(&item, copyId).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCopyNotFound
+		}
+		return nil, err
+	}
+
+	expiresAt := now.AddDate(0, 0, config.Conf.Circulation.HoldPickupDays)
+	for attempt := 0; attempt < claimAttempts; attempt++ {
+		var next model.Hold
+		err := lockForClaim(tx).Where("book_id = ? AND status = ?", item.BookId, model.HoldWaiting).Order("id ASC").First(&next).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ok, err := setCopyStatus(tx, &item, model.CopyAvailable)
+			if err == nil && !ok {
+				err = ErrCopyStatusChanged
+			}
+			return nil, err
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// 以排队状态为条件 并发归还时同一个预约只会被分配一次
+		result := tx.Model(&model.Hold{}).
+			Where("id = ? AND status = ?", next.Id, model.HoldWaiting).
+			Updates(map[string]interface{}{
+				"status":     model.HoldReady,
+				"copy_id":    item.Id,
+				"ready_at":   now,
+				"expires_at": expiresAt,
+			})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			// 已被其他请求分配或取消 继续尝试下一位
+			continue
+		}
+
+		ok, err := setCopyStatus(tx, &item, model.CopyOnHold)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrCopyStatusChanged
+		}
+		next.Status = model.HoldReady
+		next.CopyId = item.Id
+		next.ReadyAt = &now
+		next.ExpiresAt = &expiresAt
+		return &next, nil
+	}
+	return nil, ErrCopyStatusChanged
+}
+
+// CancelHold 取消预约 userId 为0时不校验预约人 已为其保留的单册转给下一位读者
+func CancelHold(tx *gorm.DB, holdId, userId int64, now time.Time) error {
+	query := tx.Where("id = ?", holdId)
+	if userId > 0 {
+		query = query.Where("user_id = ?", userId)
+	}
+	var hold model.Hold
+	if err := query.First(&hold).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrHoldNotFound
+		}
+		return err
+	}
+	if !hold.IsActive() {
+		return ErrHoldNotActive
+	}
+
+	result := tx.Model(&model.Hold{}).
+		Where("id = ? AND status = ?", hold.Id, hold.Status).
+		Update("status", model.HoldCancelled)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrHoldNotActive
+	}
+	if hold.Status == model.HoldReady {
+		_, err := ReleaseCopy(tx, hold.CopyId, now)
+		return err
+	}
+	return nil
+}
+
+// ExpireHolds 将超过取书期限的预约置为过期 并把保留的单册转给下一位读者
+func ExpireHolds(db *gorm.DB, now time.Time) (int, error) {
+	var expired []model.Hold
+	if err := db.Where("status = ? AND expires_at < ?", model.HoldReady, now).Find(&expired).Error; err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, hold := range expired {
+		var changed bool
+		err := db.Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&model.Hold{}).
+				Where("id = ? AND status = ?", hold.Id, model.HoldReady).
+				Update("status", model.HoldExpired)
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+			changed = true
+			_, err := ReleaseCopy(tx, hold.CopyId, now)
+			return err
+		})
+		if err != nil {
+			return count, err
+		}
+		// 事务提交后才计数 回滚的预约不算作已清理
+		if changed {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// RunHoldExpiry 定期清理过期的预约 需在单独的协程中运行
+func RunHoldExpiry(db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if count, err := ExpireHolds(db, now); err != nil {
+			log.Println("清理过期预约失败 err: ", err)
+		} else if count > 0 {
+			log.Printf("已清理 %d 个过期预约", count)
+		}
+	}
+}
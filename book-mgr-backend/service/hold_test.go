@@ -0,0 +1,55 @@
+package service
+
+import (
+	"book-mgr-backend/model"
+	"errors"
+	"gorm.io/gorm"
+	"sync"
+	"testing"
+)
+
+// 同一读者并发预约同一本书只会排队一次
+func TestConcurrentPlaceHoldOnce(t *testing.T) {
+	db := openTestDB(t)
+	bookId := createBookWithCopies(t, db, 1)
+	users := createReaders(t, db, 2)
+	if _, err := checkout(db, &users[0], bookId); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := db.Transaction(func(tx *gorm.DB) error {
+				_, err := PlaceHold(tx, users[1].Id, bookId)
+				return err
+			})
+			if err != nil && !errors.Is(err, ErrHoldDuplicate) {
+				t.Errorf("预约失败: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var active int64
+	if err := db.Model(&model.Hold{}).Where("user_id = ? AND book_id = ?", users[1].Id, bookId).Count(&active).Error; err != nil {
+		t.Fatal(err)
+	}
+	if active != 1 {
+		t.Errorf("有 %d 个预约 期望 1 个", active)
+	}
+}
+
+func TestPlaceHoldWhileOnLoan(t *testing.T) {
+	db := openTestDB(t)
+	bookId := createBookWithCopies(t, db, 1)
+	users := createReaders(t, db, 1)
+	if _, err := checkout(db, &users[0], bookId); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PlaceHold(db, users[0].Id, bookId); !errors.Is(err, ErrHoldOnLoan) {
+		t.Errorf("err=%v 期望 ErrHoldOnLoan", err)
+	}
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"book-mgr-backend/config"
+	"book-mgr-backend/model"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"net/http"
+	"time"
+)
+
+// MaxIdempotencyKeyLength 幂等键的最大长度
+const MaxIdempotencyKeyLength = 128
+
+// 首次请求处理中的占位时长 进程中途退出时超过该时长后允许重新处理
+const idempotencyPendingTimeout = time.Minute
+
+var (
+	ErrIdempotencyKeyTooLong = newError(http.StatusBadRequest, "Idempotency-Key 过长")
+	ErrIdempotencyInProgress = newError(http.StatusConflict, "相同的请求正在处理 请稍后重试")
+	ErrIdempotencyMismatch   = newError(http.StatusUnprocessableEntity, "Idempotency-Key 已用于内容不同的请求")
+)
+
+// BeginIdempotent 登记一次带幂等键的请求 replay 为 true 时应直接返回记录中保存的响应
+// 同一用户的键用于内容不同的请求时返回 ErrIdempotencyMismatch
+func BeginIdempotent(db *gorm.DB, userId int64, method, path, key, requestHash string, now time.Time) (record *model.IdempotencyKey, replay bool, err error) {
+	if len(key) > MaxIdempotencyKeyLength {
+		return nil, false, ErrIdempotencyKeyTooLong
+	}
+	if userId == 0 {
+		key = anonymousKey(method, path, key, requestHash)
+	}
+
+	// 过期的记录删除后再试一次
+	for attempt := 0; attempt < 2; attempt++ {
+		record = &model.IdempotencyKey{
+			UserId:      userId,
+			Method:      method,
+			Path:        path,
+			Key:         key,
+			RequestHash: requestHash,
+			Status:      model.IdempotencyPending,
+			ExpiresAt:   now.Add(idempotencyPendingTimeout),
+		}
+		// 唯一索引保证并发的重试中只有一个请求能登记成功
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+		if result.Error != nil {
+			return nil, false, result.Error
+		}
+		if result.RowsAffected == 1 {
+			return record, false, nil
+		}
+
+		var existing model.IdempotencyKey
+		// key 在 MySQL 中是保留字 使用 map 条件由方言引用列名
+		err := db.Where(map[string]interface{}{
+			"user_id": userId,
+			"method":  method,
+			"path":    path,
+			"key":     key,
+		}).First(&existing).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if existing.ExpiresAt.Before(now) {
+			if err := db.Where("id = ? AND expires_at < ?", existing.Id, now).Delete(&model.IdempotencyKey{}).Error; err != nil {
+				return nil, false, err
+			}
+			continue
+		}
+		if existing.RequestHash != requestHash {
+			return nil, false, ErrIdempotencyMismatch
+		}
+		if existing.Status != model.IdempotencyDone {
+			return nil, false, ErrIdempotencyInProgress
+		}
+		return &existing, true, nil
+	}
+	return nil, false, ErrIdempotencyInProgress
+}
+
+// anonymousKey 未登录的请求都属于用户0 不同客户端可能使用相同的键
+// 按接口和请求体摘要区分 只有内容完全相同的请求才会重放同一个响应
+func anonymousKey(method, path, key, requestHash string) string {
+	sum := sha256.Sum256([]byte(method + " " + path + "\n" + requestHash + "\n" + key))
+	return "anon:" + hex.EncodeToString(sum[:])
+}
+
+// CompleteIdempotent 保存首次请求的响应 在有效期内的重试将重放该响应
+func CompleteIdempotent(db *gorm.DB, record *model.IdempotencyKey, status int, body []byte, now time.Time) error {
+	return db.Model(&model.IdempotencyKey{}).Where("id = ?", record.Id).Updates(map[string]interface{}{
+		"status":        model.IdempotencyDone,
+		"response_code": status,
+		"response_body": string(body),
+		"expires_at":    now.Add(config.Conf.Idempotency.TTL),
+	}).Error
+}
+
+// AbandonIdempotent 首次请求因服务端错误失败时删除记录 让客户端可以用同一个键重试
+func AbandonIdempotent(db *gorm.DB, record *model.IdempotencyKey) error {
+	return db.Delete(&model.IdempotencyKey{}, record.Id).Error
+}
+
+// PurgeIdempotencyKeys 删除过期的幂等键
+func PurgeIdempotencyKeys(db *gorm.DB, now time.Time) (int64, error) {
+	result := db.Where("expires_at < ?", now).Delete(&model.IdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
+
+// RunIdempotencyPurge 定期清理过期的幂等键 需在单独的协程中运行
+func RunIdempotencyPurge(db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if count, err := PurgeIdempotencyKeys(db, now); err != nil {
+			log.Println("清理过期幂等键失败 err: ", err)
+		} else if count > 0 {
+			log.Printf("已清理 %d 个过期幂等键", count)
+		}
+	}
+}
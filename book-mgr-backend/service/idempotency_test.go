@@ -0,0 +1,60 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyReplayAndMismatch(t *testing.T) {
+	db := openTestDB(t)
+	now := time.Now()
+
+	record, replay, err := BeginIdempotent(db, 1, "POST", "/api/user/v1/borrow", "k1", "hash-a", now)
+	if err != nil || replay {
+		t.Fatalf("首次请求 replay=%v err=%v", replay, err)
+	}
+	if err := CompleteIdempotent(db, record, 200, []byte(`{"code":200}`), now); err != nil {
+		t.Fatal(err)
+	}
+
+	// 相同内容的重试重放首次响应
+	record, replay, err = BeginIdempotent(db, 1, "POST", "/api/user/v1/borrow", "k1", "hash-a", now)
+	if err != nil || !replay || record.ResponseBody != `{"code":200}` {
+		t.Fatalf("重试 replay=%v err=%v", replay, err)
+	}
+
+	// 同一个键用于不同的内容
+	if _, _, err = BeginIdempotent(db, 1, "POST", "/api/user/v1/borrow", "k1", "hash-b", now); !errors.Is(err, ErrIdempotencyMismatch) {
+		t.Fatalf("内容不同时 err=%v 期望 ErrIdempotencyMismatch", err)
+	}
+
+	// 其他用户使用相同的键互不影响
+	if _, replay, err = BeginIdempotent(db, 2, "POST", "/api/user/v1/borrow", "k1", "hash-b", now); err != nil || replay {
+		t.Fatalf("其他用户 replay=%v err=%v", replay, err)
+	}
+}
+
+func TestIdempotencyAnonymousScope(t *testing.T) {
+	db := openTestDB(t)
+	now := time.Now()
+
+	first, replay, err := BeginIdempotent(db, 0, "POST", "/api/user/v1/register", "shared", "client-a", now)
+	if err != nil || replay {
+		t.Fatalf("首次请求 replay=%v err=%v", replay, err)
+	}
+	if err := CompleteIdempotent(db, first, 200, []byte(`{"email":"a@example.com"}`), now); err != nil {
+		t.Fatal(err)
+	}
+
+	// 另一个客户端使用相同的键 不能拿到前一个客户端的响应
+	if _, replay, err = BeginIdempotent(db, 0, "POST", "/api/user/v1/register", "shared", "client-b", now); err != nil || replay {
+		t.Fatalf("其他客户端 replay=%v err=%v", replay, err)
+	}
+
+	// 内容完全相同的重试仍然重放
+	record, replay, err := BeginIdempotent(db, 0, "POST", "/api/user/v1/register", "shared", "client-a", now)
+	if err != nil || !replay || record.ResponseBody != `{"email":"a@example.com"}` {
+		t.Fatalf("重试 replay=%v err=%v", replay, err)
+	}
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"book-mgr-backend/config"
+	"book-mgr-backend/model"
+	"fmt"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+var ErrNoCopies = newReasonError(http.StatusUnprocessableEntity, ReasonNoCopies, "剩余数量不足")
+
+// CheckBorrowLimits 检查角色借阅上限 同一本书的册数上限和分类上限 需在借阅事务中调用
+func CheckBorrowLimits(tx *gorm.DB, userId int64, role string, book *model.Book) error {
+	limits := config.Conf.Limits
+
+	// 角色的同时借阅上限
+	if maxLoans := limits.MaxLoansByRole[role]; maxLoans > 0 {
+		var open int64
+		if err := tx.Model(&model.History{}).
+			Where("user_id = ? AND is_back = ?", userId, false).
+			Count(&open).Error; err != nil {
+			return err
+		}
+		if open >= int64(maxLoans) {
+			return newReasonError(http.StatusUnprocessableEntity, ReasonLoanLimit,
+				fmt.Sprintf("最多同时借阅 %d 本", maxLoans))
+		}
+	}
+
+	// 分类的覆盖配置优先于全局配置
+	maxCopies := limits.MaxCopiesPerTitle
+	category, hasCategory := limits.Categories[book.Category]
+	if hasCategory && category.MaxCopiesPerTitle > 0 {
+		maxCopies = category.MaxCopiesPerTitle
+	}
+
+	// 同一本书的册数上限
+	if maxCopies > 0 {
+		var sameTitle int64
+		if err := tx.Model(&model.History{}).
+			Where("user_id = ? AND book_id = ? AND is_back = ?", userId, book.Id, false).
+			Count(&sameTitle).Error; err != nil {
+			return err
+		}
+		if sameTitle >= int64(maxCopies) {
+			return newReasonError(http.StatusUnprocessableEntity, ReasonTitleCopyLimit,
+				fmt.Sprintf("同一本书最多借阅 %d 册", maxCopies))
+		}
+	}
+
+	// 分类的同时借阅上限
+	if hasCategory && category.MaxLoans > 0 {
+		var inCategory int64
+		if err := tx.Model(&model.History{}).
+			Joins("JOIN t_books ON t_books.id = t_history.book_id").
+			Where("t_history.user_id = ? AND t_history.is_back = ? AND t_books.category = ?", userId, false, book.Category).
+			Count(&inCategory).Error; err != nil {
+			return err
+		}
+		if inCategory >= int64(category.MaxLoans) {
+			return newReasonError(http.StatusUnprocessableEntity, ReasonCategoryLimit,
+				fmt.Sprintf("%s 类图书最多同时借阅 %d 本", book.Category, category.MaxLoans))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,368 @@
+package service
+
+import (
+	"book-mgr-backend/borrowid"
+	"book-mgr-backend/config"
+	"book-mgr-backend/model"
+	"errors"
+	"gorm.io/gorm"
+	"net/http"
+	"time"
+)
+
+// 生成借阅号时遇到重复的最大重试次数
+const borrowIdAttempts = 5
+
+var (
+	ErrLoanNotFound = newError(http.StatusNotFound, "借阅记录不存在")
+	ErrLoanReturned = newError(http.StatusConflict, "该书已归还")
+	ErrLoanChanged  = newError(http.StatusConflict, "借阅记录已变化 请重试")
+
+	ErrRenewLimit   = newError(http.StatusUnprocessableEntity, "已达到最大续借次数")
+	ErrRenewOverdue = newError(http.StatusConflict, "借阅已超期 请先归还并缴纳罚款")
+	ErrRenewHeld    = newError(http.StatusConflict, "该书已有其他读者预约 无法续借")
+
+	ErrInvalidBorrowId  = newError(http.StatusBadRequest, "借阅号校验失败 请检查是否录入有误")
+	ErrCopyUnavailable  = newError(http.StatusConflict, "该册当前不可借出")
+	ErrCopyHeldForOther = newError(http.StatusConflict, "该册已为其他读者保留")
+
+	errBorrowIdExhausted = errors.New("无法生成不重复的借阅号")
+)
+
+// NewBorrowId 生成一个库中不存在的借阅号 借阅号上的唯一索引兜底并发时的重复
+func NewBorrowId(tx *gorm.DB, now time.Time) (string, error) {
+	for i := 0; i < borrowIdAttempts; i++ {
+		id, err := borrowid.New(now)
+		if err != nil {
+			return "", err
+		}
+		var count int64
+		if err := tx.Unscoped().Model(&model.History{}).Where("borrow_id = ?", id).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return id, nil
+		}
+	}
+	return "", errBorrowIdExhausted
+}
+
+// ParseBorrowId 整理录入的借阅号 新格式的借阅号校验码不正确时返回 ErrInvalidBorrowId
+// 早期的借阅号没有校验码 原样返回
+func ParseBorrowId(input string) (string, error) {
+	id := borrowid.Normalize(input)
+	if id == "" {
+		return "", ErrLoanNotFound
+	}
+	if borrowid.IsFormatted(id) && !borrowid.Valid(id) {
+		return "", ErrInvalidBorrowId
+	}
+	return id, nil
+}
+
+// Checkout 为读者借出一册书 需在事务中调用 operatorId 为办理的馆员 读者自助借阅时为0
+// barcode 不为空时借出扫描的单册 否则优先取为读者保留的单册 再从在架的单册中任取一册
+func Checkout(tx *gorm.DB, patron *model.User, bookId int64, barcode string, operatorId int64, now time.Time) (*model.History, *model.Copy, error) {
+	// 锁定借阅人 同一用户的并发借阅依次执行
+	if err := LockUser(tx, patron.Id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrPatronNotFound
+		}
+		return nil, nil, err
+	}
+
+	var scanned *model.Copy
+	if barcode != "" {
+		scanned = &model.Copy{}
+		if err := tx.Where("barcode = ?", barcode).First(scanned).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, nil, ErrCopyNotFound
+			}
+			return nil, nil, err
+		}
+		bookId = scanned.BookId
+	}
+
+	var book model.Book
+	if err := tx.First(&book, bookId).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrBookNotFound
+		}
+		return nil, nil, err
+	}
+
+	// 欠款超过限额时不允许借阅
+	if err := CheckBalanceAllowsBorrow(tx, patron.Id); err != nil {
+		return nil, nil, err
+	}
+	// 角色 同一本书和分类的借阅上限
+	if err := CheckBorrowLimits(tx, patron.Id, patron.Role, &book); err != nil {
+		return nil, nil, err
+	}
+
+	item, err := takeCopyFor(tx, patron.Id, book.Id, scanned, now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	borrowId, err := NewBorrowId(tx, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 应还日期按配置的借阅期限计算
+	dueAt := now.AddDate(0, 0, config.Conf.Circulation.LoanDays)
+	history := model.History{
+		BorrowId:   borrowId,
+		UserId:     patron.Id,
+		BookId:     book.Id,
+		CopyId:     item.Id,
+		BorrowedAt: &now,
+		DueAt:      &dueAt,
+		IsBack:     false, // 未归还
+		OperatorId: operatorId,
+	}
+	if err := tx.Create(&history).Error; err != nil {
+		return nil, nil, err
+	}
+	return &history, item, nil
+}
+
+// takeCopyFor 确定借给读者的单册并标记为借出
+func takeCopyFor(tx *gorm.DB, userId, bookId int64, scanned *model.Copy, now time.Time) (*model.Copy, error) {
+	if scanned == nil {
+		// 有为该读者保留的预约时直接取走保留的单册 保留的单册不占用库存
+		item, err := FulfillReadyHold(tx, userId, bookId, now)
+		if err != nil || item != nil {
+			return item, err
+		}
+		return TakeCopy(tx, bookId)
+	}
+
+	switch scanned.Status {
+	case model.CopyAvailable:
+	case model.CopyOnHold:
+		// 保留的单册只能借给预约的读者
+		result := tx.Model(&model.Hold{}).
+			Where("user_id = ? AND copy_id = ? AND status = ?", userId, scanned.Id, model.HoldReady).
+			Update("status", model.HoldFulfilled)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil, ErrCopyHeldForOther
+		}
+	default:
+		return nil, ErrCopyUnavailable
+	}
+	ok, err := setCopyStatus(tx, scanned, model.CopyOnLoan)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrCopyStatusChanged
+	}
+	return scanned, nil
+}
+
+// FindOpenLoan 按借阅号或单册条码查找借阅记录 用于服务台归还
+// 按条码查找时只匹配该册当前未归还的借阅
+func FindOpenLoan(tx *gorm.DB, borrowId, barcode string) (*model.History, error) {
+	var history model.History
+	if borrowId != "" {
+		id, err := ParseBorrowId(borrowId)
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.Where("borrow_id = ?", id).First(&history).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrLoanNotFound
+			}
+			return nil, err
+		}
+		return &history, nil
+	}
+
+	var item model.Copy
+	if err := tx.Where("barcode = ?", barcode).First(&item).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCopyNotFound
+		}
+		return nil, err
+	}
+	if err := tx.Where("copy_id = ? AND is_back = ?", item.Id, false).First(&history).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrLoanNotFound
+		}
+		return nil, err
+	}
+	return &history, nil
+}
+
+// RenewLoan 续借读者自己的一笔借阅 应还日期在原有基础上顺延 需在事务中调用
+// 已超期的借阅不能续借 否则顺延后将不再产生超期罚款
+func RenewLoan(tx *gorm.DB, userId int64, borrowId string, now time.Time) (*model.History, error) {
+	var history model.History
+	if err := tx.Where("borrow_id = ? AND user_id = ?", borrowId, userId).First(&history).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrLoanNotFound
+		}
+		return nil, err
+	}
+	if history.IsBack {
+		return nil, ErrLoanReturned
+	}
+	if history.IsOverdue(now) {
+		return nil, ErrRenewOverdue
+	}
+	circulation := config.Conf.Circulation
+	if history.RenewCount >= circulation.MaxRenewals {
+		return nil, ErrRenewLimit
+	}
+	// 欠款超过限额时与借阅一样不允许续借
+	if err := CheckBalanceAllowsBorrow(tx, userId); err != nil {
+		return nil, err
+	}
+
+	// 有其他读者在排队时不能续借
+	waiting, err := HasWaitingHold(tx, history.BookId, userId)
+	if err != nil {
+		return nil, err
+	}
+	if waiting {
+		return nil, ErrRenewHeld
+	}
+
+	dueAt := now
+	if history.DueAt != nil {
+		dueAt = *history.DueAt
+	}
+	dueAt = dueAt.AddDate(0, 0, circulation.RenewDays)
+
+	// 以续借次数作为条件 防止重复提交导致多次续借
+	result := tx.Model(&model.History{}).
+		Where("id = ? AND is_back = ? AND renew_count = ?", history.Id, false, history.RenewCount).
+		Updates(map[string]interface{}{
+			"due_at":      dueAt,
+			"renew_count": history.RenewCount + 1,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrLoanChanged
+	}
+	history.DueAt = &dueAt
+	history.RenewCount++
+	return &history, nil
+}
+
+// closeLoan 以未归还为条件结束一笔借阅 已结束时返回 ErrLoanReturned
+func closeLoan(tx *gorm.DB, history *model.History, outcome string, operatorId int64, now time.Time) error {
+	if history.IsBack {
+		return ErrLoanReturned
+	}
+	result := tx.Model(&model.History{}).
+		Where("id = ? AND is_back = ?", history.Id, false).
+		Updates(map[string]interface{}{
+			"is_back":            true,
+			"returned_at":        now,
+			"outcome":            outcome,
+			"return_operator_id": operatorId,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrLoanReturned
+	}
+	history.IsBack = true
+	history.ReturnedAt = &now
+	history.Outcome = outcome
+	history.ReturnOperatorId = operatorId
+	return nil
+}
+
+// ReturnLoan 归还一笔借阅 以未归还为条件更新 重复归还时返回 ErrLoanReturned
+// 超期时记一笔罚款 归还的单册优先为预约队列中的下一位读者保留 operatorId 为办理的馆员
+func ReturnLoan(tx *gorm.DB, history *model.History, operatorId int64, now time.Time) (*model.FineEntry, error) {
+	if err := closeLoan(tx, history, model.LoanReturned, operatorId, now); err != nil {
+		return nil, err
+	}
+	fine, err := AssessOverdueFine(tx, history, now)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ReleaseCopy(tx, history.CopyId, now); err != nil {
+		return nil, err
+	}
+	return fine, nil
+}
+
+// DeclareLost 读者遗失借阅的书 单册标记为遗失 收取赔偿后不再计超期罚款
+// charge 为空时按 LostCharge 计算
+func DeclareLost(tx *gorm.DB, history *model.History, charge *int64, operatorId int64, now time.Time) (*model.FineEntry, error) {
+	if charge != nil && *charge < 0 {
+		return nil, ErrInvalidAmount
+	}
+	if err := closeLoan(tx, history, model.LoanLost, operatorId, now); err != nil {
+		return nil, err
+	}
+	book, err := retireLoanCopy(tx, history, model.CopyLost)
+	if err != nil {
+		return nil, err
+	}
+	amount := LostCharge(book)
+	if charge != nil {
+		amount = *charge
+	}
+	return ChargeReplacement(tx, history, book, model.FineLost, amount, operatorId)
+}
+
+// ReturnDamaged 归还时发现损坏 单册送修不再流通 超期照常计罚款 另收损坏赔偿
+// charge 为空时按 DamageCharge 计算
+func ReturnDamaged(tx *gorm.DB, history *model.History, charge *int64, operatorId int64, now time.Time) (fine, damage *model.FineEntry, err error) {
+	if charge != nil && *charge < 0 {
+		return nil, nil, ErrInvalidAmount
+	}
+	if err := closeLoan(tx, history, model.LoanDamaged, operatorId, now); err != nil {
+		return nil, nil, err
+	}
+	if fine, err = AssessOverdueFine(tx, history, now); err != nil {
+		return nil, nil, err
+	}
+	book, err := retireLoanCopy(tx, history, model.CopyRepair)
+	if err != nil {
+		return nil, nil, err
+	}
+	amount := DamageCharge(book)
+	if charge != nil {
+		amount = *charge
+	}
+	if damage, err = ChargeReplacement(tx, history, book, model.FineDamaged, amount, operatorId); err != nil {
+		return nil, nil, err
+	}
+	return fine, damage, nil
+}
+
+// retireLoanCopy 借出的单册不再回到书架 库存保持不变
+func retireLoanCopy(tx *gorm.DB, history *model.History, status string) (*model.Book, error) {
+	var item model.Copy
+	if err := tx.First(&item, history.CopyId).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCopyNotFound
+		}
+		return nil, err
+	}
+	ok, err := setCopyStatus(tx, &item, status)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrCopyStatusChanged
+	}
+	var book model.Book
+	if err := tx.Unscoped().First(&book, history.BookId).Error; err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"book-mgr-backend/model"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"net/http"
+	"strings"
+)
+
+var ErrPatronNotFound = newError(http.StatusNotFound, "读者不存在")
+
+// CardNo 按用户id生成借书证号
+func CardNo(userId int64) string {
+	return fmt.Sprintf("RC%08d", userId)
+}
+
+// FindPatron 按邮箱或借书证号查找读者 两者都提供时以借书证号为准
+func FindPatron(tx *gorm.DB, email, cardNo string) (*model.User, error) {
+	email, cardNo = strings.TrimSpace(email), strings.ToUpper(strings.TrimSpace(cardNo))
+	query := tx.Model(&model.User{})
+	switch {
+	case cardNo != "":
+		query = query.Where("card_no = ?", cardNo)
+	case email != "":
+		query = query.Where("email = ?", email)
+	default:
+		return nil, ErrPatronNotFound
+	}
+	var user model.User
+	if err := query.First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPatronNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
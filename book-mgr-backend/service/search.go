@@ -0,0 +1,146 @@
+package service
+
+import (
+	"book-mgr-backend/model"
+	"book-mgr-backend/search"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/http"
+)
+
+// MaxTermLength 单个词项的最大字符数 超出部分截断
+const MaxTermLength = 64
+
+var ErrEmptySearch = newError(http.StatusBadRequest, "搜索内容中没有可检索的文字")
+
+// BookSearchFields 参与全文检索的字段及权重 标题命中的得分最高
+var BookSearchFields = []struct {
+	Name   string
+	Weight int64
+	Value  func(book *model.Book) string
+}{
+	{"name", 8, func(book *model.Book) string { return book.Name }},
+	{"author", 5, func(book *model.Book) string { return book.Author }},
+	{"isbn", 5, func(book *model.Book) string { return book.ISBN }},
+	{"publisher", 3, func(book *model.Book) string { return book.Publisher }},
+	{"category", 3, func(book *model.Book) string { return book.Category }},
+	{"remark", 1, func(book *model.Book) string { return book.Remark }},
+}
+
+// BookTerms 计算一本书的索引行
+func BookTerms(book *model.Book) []model.BookTerm {
+	var rows []model.BookTerm
+	for _, field := range BookSearchFields {
+		counts := map[string]int64{}
+		var order []string
+		for _, term := range search.Terms(field.Value(book)) {
+			if runes := []rune(term); len(runes) > MaxTermLength {
+				term = string(runes[:MaxTermLength])
+			}
+			if counts[term] == 0 {
+				order = append(order, term)
+			}
+			counts[term]++
+		}
+		for _, term := range order {
+			rows = append(rows, model.BookTerm{
+				BookId: book.Id,
+				Field:  field.Name,
+				Term:   term,
+				Weight: field.Weight * counts[term],
+			})
+		}
+	}
+	return rows
+}
+
+// IndexBook 重建一本书的索引 新增和修改图书时与图书在同一事务中调用
+func IndexBook(tx *gorm.DB, book *model.Book) error {
+	if err := UnindexBook(tx, book.Id); err != nil {
+		return err
+	}
+	rows := BookTerms(book)
+	if len(rows) == 0 {
+		return nil
+	}
+	return tx.CreateInBatches(rows, 200).Error
+}
+
+// ReindexBooks 按当前的分词和拼音规则重建全部图书的索引和拼音检索键 规则调整后执行 返回处理的图书数
+func ReindexBooks(db *gorm.DB) (int, error) {
+	count := 0
+	var books []model.Book
+	result := db.FindInBatches(&books, 200, func(batch *gorm.DB, _ int) error {
+		return db.Transaction(func(tx *gorm.DB) error {
+			for i := range books {
+				book := &books[i]
+				FillBookPinyin(book)
+				if err := tx.Model(book).Select("name_pinyin", "name_initials", "author_pinyin", "author_initials").
+					UpdateColumns(book).Error; err != nil {
+					return err
+				}
+				if err := IndexBook(tx, book); err != nil {
+					return err
+				}
+			}
+			count += len(books)
+			return nil
+		})
+	})
+	return count, result.Error
+}
+
+// UnindexBook 删除一本书的索引
+func UnindexBook(tx *gorm.DB, bookId int64) error {
+	return tx.Where("book_id = ?", bookId).Delete(&model.BookTerm{}).Error
+}
+
+// FillBookPinyin 计算书名和作者的拼音检索键 保存图书前调用
+func FillBookPinyin(book *model.Book) {
+	book.NamePinyin, book.NameInitials = search.Pinyin(book.Name)
+	book.AuthorPinyin, book.AuthorInitials = search.Pinyin(book.Author)
+}
+
+// 拼音命中时的得分 与全文检索中对应字段的权重一致
+const (
+	namePinyinScore   = 8
+	authorPinyinScore = 5
+)
+
+// ApplyBookSearch 给图书查询加上全文检索 返回相关度得分的表达式和用于高亮的词项
+// 全文检索必须命中全部查询词项 得分为命中词项的权重之和
+// 查询像拼音时 书名或作者的全拼 首字母包含该查询也算命中
+func ApplyBookSearch(query *gorm.DB, q string) (*gorm.DB, clause.Expr, []string, error) {
+	terms := search.QueryTerms(q)
+	if len(terms) == 0 {
+		return nil, clause.Expr{}, nil, ErrEmptySearch
+	}
+	for i, term := range terms {
+		if runes := []rune(term); len(runes) > MaxTermLength {
+			terms[i] = string(runes[:MaxTermLength])
+		}
+	}
+	matches := query.Session(&gorm.Session{NewDB: true}).Model(&model.BookTerm{}).
+		Select("book_id, SUM(weight) AS score").
+		Where("term IN ?", terms).
+		Group("book_id").
+		Having("COUNT(DISTINCT term) = ?", len(terms))
+
+	key, isPinyin := search.PinyinQuery(q)
+	if !isPinyin {
+		query = query.Joins("JOIN (?) AS book_matches ON book_matches.book_id = t_books.id", matches)
+		return query, clause.Expr{SQL: "book_matches.score"}, terms, nil
+	}
+
+	like := "%" + key + "%"
+	score := clause.Expr{
+		SQL: "COALESCE(book_matches.score, 0)" +
+			" + CASE WHEN t_books.name_pinyin LIKE ? OR t_books.name_initials LIKE ? THEN ? ELSE 0 END" +
+			" + CASE WHEN t_books.author_pinyin LIKE ? OR t_books.author_initials LIKE ? THEN ? ELSE 0 END",
+		Vars: []interface{}{like, like, namePinyinScore, like, like, authorPinyinScore},
+	}
+	query = query.Joins("LEFT JOIN (?) AS book_matches ON book_matches.book_id = t_books.id", matches).
+		Where("book_matches.book_id IS NOT NULL OR t_books.name_pinyin LIKE ? OR t_books.name_initials LIKE ?"+
+			" OR t_books.author_pinyin LIKE ? OR t_books.author_initials LIKE ?", like, like, like, like)
+	return query, score, terms, nil
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"book-mgr-backend/model"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LockUser 锁定用户行 使同一用户的借阅请求串行执行 避免并发时绕过借阅上限
+// SQLite 不支持行锁 由 _txlock=immediate 保证写事务串行
+func LockUser(tx *gorm.DB, userId int64) error {
+	var user model.User
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", userId).First(&user).Error
+}
+
+// claimAttempts 选中的行被并发修改时重新选取的最大次数 超过后返回 ErrCopyStatusChanged
+const claimAttempts = 3
+
+// lockForClaim 选取待占用的单册或预约时加行锁 并跳过其他事务已锁定的行
+// 在 MySQL 的可重复读下 不加锁的读取在同一事务中总是返回同一快照 条件更新失败后重选也无济于事
+// SQLite 不支持行锁 由 _txlock=immediate 保证写事务串行
+func lockForClaim(tx *gorm.DB) *gorm.DB {
+	switch tx.Dialector.Name() {
+	case "mysql", "postgres":
+		return tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+	}
+	return tx
+}
+
+// TakeCopy 从在架的单册中取一册借出 没有可借的单册时返回 ErrNoCopies
+// 多次选中的单册都被并发借走时返回 ErrCopyStatusChanged
+func TakeCopy(tx *gorm.DB, bookId int64) (*model.Copy, error) {
+	for attempt := 0; attempt < claimAttempts; attempt++ {
+		var item model.Copy
+		err := lockForClaim(tx).Where("book_id = ? AND status = ?", bookId, model.CopyAvailable).Order("id ASC").First(&item).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNoCopies
+		}
+		if err != nil {
+			return nil, err
+		}
+		ok, err := setCopyStatus(tx, &item, model.CopyOnLoan)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return &item, nil
+		}
+		// 已被并发的请求借走 换下一册
+	}
+	return nil, ErrCopyStatusChanged
+}
+
+// setCopyStatus 以当前状态为条件修改单册状态 状态已被并发修改时返回 false
+// 在架数量变化时同步图书的库存
+func setCopyStatus(tx *gorm.DB, item *model.Copy, status string) (bool, error) {
+	result := tx.Model(&model.Copy{}).
+		Where("id = ? AND status = ?", item.Id, item.Status).
+		Update("status", status)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	var delta int64
+	if item.Status == model.CopyAvailable {
+		delta--
+	}
+	if status == model.CopyAvailable {
+		delta++
+	}
+	item.Status = status
+	if delta == 0 {
+		return true, nil
+	}
+	return true, tx.Model(&model.Book{}).
+		Where("id = ?", item.BookId).
+		Update("residue", gorm.Expr("residue + ?", delta)).Error
+}
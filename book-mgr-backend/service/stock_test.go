@@ -0,0 +1,228 @@
+package service
+
+import (
+	"book-mgr-backend/config"
+	"book-mgr-backend/dao"
+	"book-mgr-backend/migration"
+	"book-mgr-backend/model"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// openTestDB 在临时目录中创建 SQLite 数据库并执行全部迁移
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	conf := config.Default()
+	conf.Database.Path = filepath.Join(t.TempDir(), "test.db")
+	config.Conf = conf
+	dao.InitDatabase()
+	if _, err := migration.Up(dao.Db); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDb, err := dao.Db.DB(); err == nil {
+			sqlDb.Close()
+		}
+	})
+	return dao.Db
+}
+
+func createReaders(t *testing.T, db *gorm.DB, count int) []model.User {
+	t.Helper()
+	users := make([]model.User, count)
+	for i := range users {
+		users[i] = model.User{Email: fmt.Sprintf("reader-%d@example.com", i), Role: model.RoleReader}
+	}
+	if err := db.Create(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	return users
+}
+
+func createBookWithCopies(t *testing.T, db *gorm.DB, copies int) int64 {
+	t.Helper()
+	book := model.Book{Name: "并发测试", Author: "stress", Price: 1}
+	if err := db.Create(&book).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		_, err := AddCopies(tx, book.Id, nil, copies, now, now)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return book.Id
+}
+
+// assertStock 库存不能为负数 且与在架的单册数一致
+func assertStock(t *testing.T, db *gorm.DB, bookId int64) int64 {
+	t.Helper()
+	var book model.Book
+	if err := db.First(&book, bookId).Error; err != nil {
+		t.Fatal(err)
+	}
+	var available int64
+	if err := db.Model(&model.Copy{}).Where("book_id = ? AND status = ?", bookId, model.CopyAvailable).Count(&available).Error; err != nil {
+		t.Fatal(err)
+	}
+	if book.Residue < 0 {
+		t.Errorf("库存为负数: %d", book.Residue)
+	}
+	if book.Residue != available {
+		t.Errorf("库存 %d 与在架单册数 %d 不一致", book.Residue, available)
+	}
+	return book.Residue
+}
+
+func checkout(db *gorm.DB, patron *model.User, bookId int64) (*model.History, error) {
+	var history *model.History
+	err := db.Transaction(func(tx *gorm.DB) (err error) {
+		history, _, err = Checkout(tx, patron, bookId, "", 0, time.Now())
+		return err
+	})
+	return history, err
+}
+
+func returnLoan(db *gorm.DB, historyId int64) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var history model.History
+		if err := tx.First(&history, historyId).Error; err != nil {
+			return err
+		}
+		_, err := ReturnLoan(tx, &history, 0, time.Now())
+		return err
+	})
+}
+
+func TestConcurrentCheckoutNeverOversells(t *testing.T) {
+	db := openTestDB(t)
+	const stock, readers = 5, 20
+	bookId := createBookWithCopies(t, db, stock)
+	users := createReaders(t, db, readers)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var loans []*model.History
+	for i := range users {
+		wg.Add(1)
+		go func(patron *model.User) {
+			defer wg.Done()
+			history, err := checkout(db, patron, bookId)
+			if err != nil {
+				if !errors.Is(err, ErrNoCopies) {
+					t.Errorf("借阅失败: %v", err)
+				}
+				return
+			}
+			mu.Lock()
+			loans = append(loans, history)
+			mu.Unlock()
+		}(&users[i])
+	}
+	wg.Wait()
+
+	if len(loans) != stock {
+		t.Errorf("借出 %d 册 期望 %d 册", len(loans), stock)
+	}
+	if residue := assertStock(t, db, bookId); residue != 0 {
+		t.Errorf("借完后库存为 %d", residue)
+	}
+}
+
+func TestConcurrentDuplicateReturnCountsOnce(t *testing.T) {
+	db := openTestDB(t)
+	const stock, duplicates = 3, 5
+	bookId := createBookWithCopies(t, db, stock)
+	users := createReaders(t, db, stock)
+
+	var loans []*model.History
+	for i := range users {
+		history, err := checkout(db, &users[i], bookId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loans = append(loans, history)
+	}
+	assertStock(t, db, bookId)
+
+	// 每笔借阅同时发出多次归还 只有一次能成功
+	var wg sync.WaitGroup
+	succeeded := make([]int, len(loans))
+	var mu sync.Mutex
+	for i, loan := range loans {
+		for j := 0; j < duplicates; j++ {
+			wg.Add(1)
+			go func(i int, historyId int64) {
+				defer wg.Done()
+				err := returnLoan(db, historyId)
+				if err != nil {
+					if !errors.Is(err, ErrLoanReturned) {
+						t.Errorf("归还失败: %v", err)
+					}
+					return
+				}
+				mu.Lock()
+				succeeded[i]++
+				mu.Unlock()
+			}(i, loan.Id)
+		}
+	}
+	wg.Wait()
+
+	for i, count := range succeeded {
+		if count != 1 {
+			t.Errorf("借阅 %d 归还成功 %d 次 期望 1 次", loans[i].Id, count)
+		}
+	}
+	if residue := assertStock(t, db, bookId); residue != stock {
+		t.Errorf("全部归还后库存为 %d 期望 %d", residue, stock)
+	}
+}
+
+func TestConcurrentCheckoutAndReturn(t *testing.T) {
+	db := openTestDB(t)
+	const stock, readers, rounds = 2, 8, 5
+	bookId := createBookWithCopies(t, db, stock)
+	users := createReaders(t, db, readers)
+
+	// 每位读者反复借还 借不到时重试下一轮
+	var wg sync.WaitGroup
+	for i := range users {
+		wg.Add(1)
+		go func(patron *model.User) {
+			defer wg.Done()
+			for round := 0; round < rounds; round++ {
+				history, err := checkout(db, patron, bookId)
+				if errors.Is(err, ErrNoCopies) {
+					continue
+				}
+				if err != nil {
+					t.Errorf("借阅失败: %v", err)
+					return
+				}
+				if err := returnLoan(db, history.Id); err != nil {
+					t.Errorf("归还失败: %v", err)
+					return
+				}
+			}
+		}(&users[i])
+	}
+	wg.Wait()
+
+	if residue := assertStock(t, db, bookId); residue != stock {
+		t.Errorf("借还结束后库存为 %d 期望 %d", residue, stock)
+	}
+	var open int64
+	if err := db.Model(&model.History{}).Where("is_back = ?", false).Count(&open).Error; err != nil {
+		t.Fatal(err)
+	}
+	if open != 0 {
+		t.Errorf("仍有 %d 笔借阅未归还", open)
+	}
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"book-mgr-backend/model"
+	"book-mgr-backend/search"
+	"gorm.io/gorm"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	// MaxSuggestions 联想建议最多返回的条数
+	MaxSuggestions = 20
+	// fuzzyCandidateLimit 纠错时每个字段最多比较的图书数
+	fuzzyCandidateLimit = 200
+	// fuzzyPrefixLength 候选图书需有词项与查询词项的前几个字相同
+	fuzzyPrefixLength = 2
+	// fuzzyMaxPrefixes 参与筛选候选的查询词项前缀数
+	fuzzyMaxPrefixes = 16
+	// fuzzyThreshold 相似度达到该值才作为纠错建议
+	fuzzyThreshold = 0.6
+)
+
+// Suggestion 一条联想建议
+type Suggestion struct {
+	Text  string `json:"text"`
+	Field string `json:"field"` // name author publisher
+}
+
+// 参与联想和纠错的字段 按优先级排列 拼音列为空表示不支持拼音
+var suggestFields = []struct {
+	name, column, pinyin, initials string
+}{
+	{"name", "name", "name_pinyin", "name_initials"},
+	{"author", "author", "author_pinyin", "author_initials"},
+	{"publisher", "publisher", "", ""},
+}
+
+// SuggestBooks 输入过程中的联想建议 先返回前缀匹配 再返回包含匹配
+// 书名和作者同时按拼音全拼和首字母匹配
+func SuggestBooks(tx *gorm.DB, q string, limit int) ([]Suggestion, error) {
+	q = strings.TrimSpace(q)
+	if q == "" {
+		return []Suggestion{}, nil
+	}
+	if limit <= 0 || limit > MaxSuggestions {
+		limit = MaxSuggestions
+	}
+	key, isPinyin := search.PinyinQuery(q)
+	pattern := escapeLike(q)
+
+	suggestions := []Suggestion{}
+	seen := map[Suggestion]bool{}
+	for _, prefix := range []bool{true, false} {
+		for _, field := range suggestFields {
+			if len(suggestions) >= limit {
+				return suggestions, nil
+			}
+			like := pattern + "%"
+			pinyinLike := key + "%"
+			if !prefix {
+				like, pinyinLike = "%"+like, "%"+pinyinLike
+			}
+			query := tx.Model(&model.Book{}).Distinct(field.column).
+				Where(field.column + " <> ''").Limit(limit)
+			if isPinyin && field.pinyin != "" {
+				query = query.Where(field.column+" LIKE ? ESCAPE '!' OR "+field.pinyin+" LIKE ? OR "+field.initials+" LIKE ?",
+					like, pinyinLike, pinyinLike)
+			} else {
+				query = query.Where(field.column+" LIKE ? ESCAPE '!'", like)
+			}
+			var values []string
+			if err := query.Order(field.column).Pluck(field.column, &values).Error; err != nil {
+				return nil, err
+			}
+			for _, value := range values {
+				suggestion := Suggestion{Text: value, Field: field.name}
+				if seen[suggestion] || len(suggestions) >= limit {
+					continue
+				}
+				seen[suggestion] = true
+				suggestions = append(suggestions, suggestion)
+			}
+		}
+	}
+	return suggestions, nil
+}
+
+// DidYouMean 精确检索没有结果时 从书名 作者和出版社中找出与查询最相近的取值
+// 只比较索引中有词项与查询词项前缀相同的图书 fields 不为空时只在这些字段中查找
+// 没有足够相近的取值时返回 nil
+func DidYouMean(tx *gorm.DB, q string, fields ...string) (*Suggestion, error) {
+	q = strings.TrimSpace(q)
+	prefixes := fuzzyPrefixes(q)
+	if len(prefixes) == 0 {
+		return nil, nil
+	}
+	conditions := make([]string, len(prefixes))
+	vars := make([]interface{}, len(prefixes))
+	for i, prefix := range prefixes {
+		conditions[i] = "term LIKE ? ESCAPE '!'"
+		vars[i] = escapeLike(prefix) + "%"
+	}
+	termMatch := "(" + strings.Join(conditions, " OR ") + ")"
+
+	type candidate struct {
+		Suggestion
+		score float64
+	}
+	var candidates []candidate
+	for _, field := range suggestFields {
+		if len(fields) > 0 && !slices.Contains(fields, field.name) {
+			continue
+		}
+		// 共有前缀最多的图书优先
+		matches := tx.Model(&model.BookTerm{}).
+			Select("book_id, COUNT(*) AS hits").
+			Where("field = ?", field.name).Where(termMatch, vars...).
+			Group("book_id").Order("hits DESC").Limit(fuzzyCandidateLimit)
+		var values []string
+		if err := tx.Model(&model.Book{}).
+			Joins("JOIN (?) AS fuzzy_matches ON fuzzy_matches.book_id = t_books.id", matches).
+			Distinct("t_books."+field.column).Where("t_books."+field.column+" <> ''").
+			Pluck("t_books."+field.column, &values).Error; err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			if score := search.BestSimilarity(q, value); score >= fuzzyThreshold {
+				candidates = append(candidates, candidate{Suggestion{Text: value, Field: field.name}, score})
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	// 相似度相同时优先书名 其次取较短的取值
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return len([]rune(candidates[i].Text)) < len([]rune(candidates[j].Text))
+	})
+	return &candidates[0].Suggestion, nil
+}
+
+// fuzzyPrefixes 查询词项的前缀 去重后最多取 fuzzyMaxPrefixes 个
+func fuzzyPrefixes(q string) []string {
+	var prefixes []string
+	seen := map[string]bool{}
+	for _, term := range search.QueryTerms(q) {
+		if runes := []rune(term); len(runes) > fuzzyPrefixLength {
+			term = string(runes[:fuzzyPrefixLength])
+		}
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+		if prefixes = append(prefixes, term); len(prefixes) == fuzzyMaxPrefixes {
+			break
+		}
+	}
+	return prefixes
+}
+
+// escapeLike 转义 LIKE 中的通配符 以 ! 作为转义符 各数据库的写法一致
+func escapeLike(text string) string {
+	return strings.NewReplacer(`!`, `!!`, `%`, `!%`, `_`, `!_`).Replace(text)
+}
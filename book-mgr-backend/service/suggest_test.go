@@ -0,0 +1,48 @@
+package service
+
+import (
+	"book-mgr-backend/model"
+	"gorm.io/gorm"
+	"testing"
+)
+
+func createIndexedBooks(t *testing.T, db *gorm.DB, books ...model.Book) {
+	t.Helper()
+	for i := range books {
+		if err := db.Create(&books[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := IndexBook(db, &books[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDidYouMean(t *testing.T) {
+	db := openTestDB(t)
+	createIndexedBooks(t, db,
+		model.Book{Name: "三国演义", Author: "罗贯中", Publisher: "人民文学出版社"},
+		model.Book{Name: "The Go Programming Language", Author: "Alan Donovan", Publisher: "Addison-Wesley"},
+	)
+	cases := []struct {
+		q      string
+		fields []string
+		want   *Suggestion
+	}{
+		{"三过演义", nil, &Suggestion{Text: "三国演义", Field: "name"}},
+		{"donavan", nil, &Suggestion{Text: "Alan Donovan", Field: "author"}},
+		{"progamming", nil, &Suggestion{Text: "The Go Programming Language", Field: "name"}},
+		{"三过演义", []string{"publisher"}, nil},
+		{"红楼梦", nil, nil},
+		{"  ", nil, nil},
+	}
+	for _, c := range cases {
+		got, err := DidYouMean(db, c.q, c.fields...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (got == nil) != (c.want == nil) || (got != nil && *got != *c.want) {
+			t.Errorf("DidYouMean(%q, %v) = %+v 期望 %+v", c.q, c.fields, got, c.want)
+		}
+	}
+}